@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const defaultAliasFile = "aliases.json"
+
+// fighterAlias maps the other identities of a fighter to one canonical ESPN ID: the IDs of
+// duplicate athlete records, and names the fighter went by or was misspelled as
+type fighterAlias struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name,omitempty"` // The name the fighter is written out as, when ESPN's varies
+	IDs   []string `json:"ids,omitempty"`
+	Names []string `json:"names,omitempty"`
+}
+
+// aliasTable resolves the IDs and name keys in the alias file to their fighter's entry
+type aliasTable struct {
+	entries []fighterAlias
+	byID    map[string]*fighterAlias
+	byKey   map[string]*fighterAlias
+}
+
+// loadAliasTable reads the alias file named by MMA_ALIAS_FILE (default aliases.json). Without
+// the default file no fighters are merged; aliases.example.json shows the format.
+func loadAliasTable() (*aliasTable, error) {
+	path := os.Getenv("MMA_ALIAS_FILE")
+	if path == "" {
+		path = defaultAliasFile
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && path == defaultAliasFile {
+		return newAliasTable(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []fighterAlias
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	table, err := newAliasTable(entries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return table, nil
+}
+
+func newAliasTable(entries []fighterAlias) (*aliasTable, error) {
+	t := &aliasTable{
+		entries: entries,
+		byID:    make(map[string]*fighterAlias),
+		byKey:   make(map[string]*fighterAlias),
+	}
+	for i := range t.entries {
+		entry := &t.entries[i]
+		if entry.ID == "" {
+			return nil, fmt.Errorf("entry %d has no id", i+1)
+		}
+		for _, id := range append([]string{entry.ID}, entry.IDs...) {
+			if other, ok := t.byID[id]; ok && other != entry {
+				return nil, fmt.Errorf("id %s belongs to both %s and %s", id, other.ID, entry.ID)
+			}
+			t.byID[id] = entry
+		}
+		if entry.Name != "" && nameKey(entry.Name) == "" {
+			return nil, fmt.Errorf("entry %s has a blank name", entry.ID)
+		}
+		names := entry.Names
+		if entry.Name != "" {
+			names = append([]string{entry.Name}, names...)
+		}
+		for _, name := range names {
+			key := nameKey(name)
+			if key == "" {
+				return nil, fmt.Errorf("entry %s has a blank name", entry.ID)
+			}
+			if other, ok := t.byKey[key]; ok && other != entry {
+				return nil, fmt.Errorf("name %q belongs to both %s and %s", name, other.ID, entry.ID)
+			}
+			t.byKey[key] = entry
+		}
+	}
+	return t, nil
+}
+
+// resolve returns the key a scraped fighter is stored under. A fighter in the alias table is
+// given its canonical ID and name and is stored under that ID, so every page and spelling of
+// them merges into one entry. A name only resolves for a page without an ID, or with the
+// entry's own IDs, since two fighters can share a name.
+func (t *aliasTable) resolve(fighterKey string, stats *FighterStats) string {
+	entry, ok := t.byID[stats.ID]
+	if !ok && fighterKey != "" {
+		if named, found := t.byKey[nameKey(fighterKey)]; found && stats.ID == "" {
+			entry, ok = named, true
+		}
+	}
+	if !ok {
+		return fighterKey
+	}
+
+	stats.ID = entry.ID
+	if entry.Name != "" {
+		nameParts := strings.Fields(entry.Name)
+		stats.FirstName = nameParts[0]
+		stats.LastName = strings.Join(nameParts[1:], " ")
+	}
+	return entry.ID
+}
+
+// addTo makes the aliased fighters of a snapshot findable by their other IDs and names
+func (t *aliasTable) addTo(index *queryIndex) {
+	for _, entry := range t.entries {
+		fighter, ok := index.byID[entry.ID]
+		if !ok {
+			continue
+		}
+		for _, id := range entry.IDs {
+			if _, taken := index.byID[id]; !taken {
+				index.byID[id] = fighter
+			}
+		}
+		for _, name := range entry.Names {
+			index.search.addAlias(entry.ID, name)
+		}
+	}
+}
+
+// aliasedIDs reports whether the alias table already treats two IDs as the same fighter
+func (t *aliasTable) aliasedIDs(a, b string) bool {
+	entry, ok := t.byID[a]
+	return ok && t.byID[b] == entry
+}
+
+// duplicatePair is two fighters in a snapshot who are likely the same person
+type duplicatePair struct {
+	A, B       *FighterStats
+	Birthdate  string
+	Similarity float64 // Of the names, from 0 to 1
+}
+
+// minDuplicateSimilarity is how alike two names born on the same day must be to be reported
+const minDuplicateSimilarity = 0.75
+
+// findDuplicates pairs the fighters who were born on the same day and have similar names,
+// most similar first. Pairs the alias table already merges are left out.
+func findDuplicates(fighters []*FighterStats, aliases *aliasTable) []duplicatePair {
+	byBirthdate := make(map[string][]*FighterStats)
+	for _, fighter := range fighters {
+		if birthdate := birthdateKey(fighter.Birthdate); birthdate != "" {
+			byBirthdate[birthdate] = append(byBirthdate[birthdate], fighter)
+		}
+	}
+
+	var pairs []duplicatePair
+	for birthdate, born := range byBirthdate {
+		for i := range born {
+			for j := i + 1; j < len(born); j++ {
+				a, b := born[i], born[j]
+				if aliases.aliasedIDs(fighterID(a), fighterID(b)) {
+					continue
+				}
+				if similarity := nameSimilarity(fighterName(a), fighterName(b)); similarity >= minDuplicateSimilarity {
+					if fighterID(a) > fighterID(b) {
+						a, b = b, a
+					}
+					pairs = append(pairs, duplicatePair{A: a, B: b, Birthdate: birthdate, Similarity: similarity})
+				}
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Similarity != pairs[j].Similarity {
+			return pairs[i].Similarity > pairs[j].Similarity
+		}
+		return fighterID(pairs[i].A) < fighterID(pairs[j].A)
+	})
+	return pairs
+}
+
+// birthdateKey drops the age ESPN writes after a birthdate, e.g. "7/14/1988 (36)", which
+// changes between scrapes of the same fighter
+func birthdateKey(birthdate string) string {
+	if i := strings.Index(birthdate, "("); i >= 0 {
+		birthdate = birthdate[:i]
+	}
+	return strings.TrimSpace(birthdate)
+}
+
+// nameSimilarity scores how alike two names are, from 0 to 1. Accents, case and spacing are
+// ignored, a name that contains every word of the other scores 0.9, and otherwise the score
+// falls with the number of typos between them.
+func nameSimilarity(a, b string) float64 {
+	a, b = nameKey(a), nameKey(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	joinedA, joinedB := strings.ReplaceAll(a, " ", ""), strings.ReplaceAll(b, " ", "")
+	if joinedA == joinedB {
+		return 1
+	}
+	if containsWords(a, b) || containsWords(b, a) {
+		return 0.9
+	}
+	longest := max(len([]rune(joinedA)), len([]rune(joinedB)))
+	limit := longest / 4
+	distance := editDistance(joinedA, joinedB, limit)
+	if distance > limit {
+		return 0
+	}
+	return 1 - float64(distance)/float64(longest)
+}
+
+// containsWords reports whether every word of b is a word of a
+func containsWords(a, b string) bool {
+	words := strings.Fields(a)
+	for _, word := range strings.Fields(b) {
+		if !containsString(words, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// duplicateAliases turns duplicate pairs into alias file entries. Pairs that share a fighter,
+// such as A-B and A-C, make one entry, since the alias table takes each ID once. The fighter
+// of a group with the most fights is the likelier canonical record; the others become its
+// other names and IDs.
+func duplicateAliases(pairs []duplicatePair) []fighterAlias {
+	// Group the fighters with a union-find, keeping the order they first appear in
+	parent := make(map[*FighterStats]*FighterStats)
+	var order []*FighterStats
+	find := func(fighter *FighterStats) *FighterStats {
+		if _, ok := parent[fighter]; !ok {
+			parent[fighter] = fighter
+			order = append(order, fighter)
+		}
+		for parent[fighter] != fighter {
+			fighter = parent[fighter]
+		}
+		return fighter
+	}
+	for _, pair := range pairs {
+		if a, b := find(pair.A), find(pair.B); a != b {
+			parent[b] = a
+		}
+	}
+
+	var roots []*FighterStats
+	groups := make(map[*FighterStats][]*FighterStats)
+	for _, fighter := range order {
+		root := find(fighter)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], fighter)
+	}
+
+	entries := make([]fighterAlias, 0, len(roots))
+	for _, root := range roots {
+		group := groups[root]
+		keep := group[0]
+		for _, fighter := range group[1:] {
+			if len(fighter.Fights) > len(keep.Fights) || len(fighter.Fights) == len(keep.Fights) && fighterID(fighter) < fighterID(keep) {
+				keep = fighter
+			}
+		}
+		entry := fighterAlias{ID: fighterID(keep), Name: fighterName(keep)}
+		names := map[string]bool{nameKey(entry.Name): true}
+		for _, drop := range group {
+			if drop == keep {
+				continue
+			}
+			if name := fighterName(drop); !names[nameKey(name)] {
+				names[nameKey(name)] = true
+				entry.Names = append(entry.Names, name)
+			}
+			if drop.ID != "" && drop.ID != keep.ID && !containsString(entry.IDs, drop.ID) {
+				entry.IDs = append(entry.IDs, drop.ID)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// runDuplicatesCommand reports the fighters of a snapshot who are likely the same person
+func runDuplicatesCommand(args []string) error {
+	flags, v := newCommandFlags("duplicates", "")
+	data := flags.String("data", "", "snapshot to check (default the database or file the sinks write)")
+	asJSON := flags.Bool("json", false, "print the pairs as alias file entries to review and add")
+	if err := parseCommandFlags(flags, v, args, 0); err != nil {
+		return err
+	}
+	if *data == "" {
+		*data = defaultServeData()
+	}
+
+	aliases, err := loadAliasTable()
+	if err != nil {
+		return fmt.Errorf("reading aliases: %v", err)
+	}
+	snapshot, err := loadSnapshot(*data)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", *data, err)
+	}
+	fighters := make([]*FighterStats, len(snapshot.Fighters))
+	for i := range snapshot.Fighters {
+		fighters[i] = &snapshot.Fighters[i]
+	}
+	pairs := findDuplicates(fighters, aliases)
+
+	if *asJSON {
+		entries := duplicateAliases(pairs)
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	if len(pairs) == 0 {
+		progressf("No likely duplicates among %d fighters\n", len(fighters))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SIMILARITY\tBIRTHDATE\tID\tNAME\tID\tNAME")
+	for _, pair := range pairs {
+		fmt.Fprintf(w, "%.2f\t%s\t%s\t%s\t%s\t%s\n", pair.Similarity, pair.Birthdate, fighterID(pair.A), fighterName(pair.A), fighterID(pair.B), fighterName(pair.B))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewAliasTableRejectsBadEntries(t *testing.T) {
+	tests := []struct {
+		entries []fighterAlias
+		want    string
+	}{
+		{[]fighterAlias{{Name: "Conor McGregor"}}, "has no id"},
+		{[]fighterAlias{{ID: "3022677", Name: "   "}}, "blank name"},
+		{[]fighterAlias{{ID: "3022677", Names: []string{"Connor McGregor", " - "}}}, "blank name"},
+		{[]fighterAlias{{ID: "3022677", IDs: []string{"1"}}, {ID: "2335639", IDs: []string{"1"}}}, "belongs to both"},
+		{[]fighterAlias{{ID: "3022677", Names: []string{"Conor"}}, {ID: "2335639", Names: []string{"CONOR"}}}, "belongs to both"},
+	}
+	for _, test := range tests {
+		_, err := newAliasTable(test.entries)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("newAliasTable(%+v) = %v, want an error containing %q", test.entries, err, test.want)
+		}
+	}
+}
+
+func TestAliasTableResolve(t *testing.T) {
+	table, err := newAliasTable([]fighterAlias{
+		{ID: "3022677", Name: "Conor McGregor", IDs: []string{"1"}, Names: []string{"Connor McGregor"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key, id, first, last       string
+		wantKey, wantID, wantFirst string
+	}{
+		// By the canonical ID or another ID, renamed
+		{"conor mcgregor", "3022677", "Conor", "McGregor", "3022677", "3022677", "Conor"},
+		{"connor mcgregor", "1", "Connor", "McGregor", "3022677", "3022677", "Conor"},
+		// By name, only without an ID
+		{"connor mcgregor", "", "Connor", "McGregor", "3022677", "3022677", "Conor"},
+		{"connor mcgregor", "2", "Connor", "McGregor", "connor mcgregor", "2", "Connor"},
+		// Not in the table
+		{"dustin poirier", "2335639", "Dustin", "Poirier", "dustin poirier", "2335639", "Dustin"},
+	}
+	for _, test := range tests {
+		stats := &FighterStats{ID: test.id, FirstName: test.first, LastName: test.last}
+		key := table.resolve(test.key, stats)
+		if key != test.wantKey || stats.ID != test.wantID || stats.FirstName != test.wantFirst {
+			t.Errorf("resolve(%q, %q) = %q, %s %s, want %q, %s %s", test.key, test.id, key, stats.ID, stats.FirstName, test.wantKey, test.wantID, test.wantFirst)
+		}
+	}
+}
+
+// The example alias file is one a crawl would accept
+func TestAliasExampleFile(t *testing.T) {
+	data, err := os.ReadFile("aliases.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []fighterAlias
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAliasTable(entries); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBirthdateKey(t *testing.T) {
+	tests := []struct{ birthdate, want string }{
+		{"7/14/1988 (36)", "7/14/1988"},
+		{"7/14/1988 (37)", "7/14/1988"},
+		{" 7/14/1988 ", "7/14/1988"},
+		{"7/14/1988", "7/14/1988"},
+		{"(36)", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := birthdateKey(test.birthdate); got != test.want {
+			t.Errorf("birthdateKey(%q) = %q, want %q", test.birthdate, got, test.want)
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		// Accents, case, punctuation and spacing are ignored
+		{"José Aldo", "jose aldo", 1},
+		{"Junior Dos Santos", "Junior dos-Santos", 1},
+		{"Junior Dos Santos", "Junior DosSantos", 1},
+		// Every word of one name is in the other
+		{"Junior Dos Santos", "Junior Santos", 0.9},
+		{"Santos", "Junior Dos Santos", 0.9},
+		// Typos, up to a quarter of the longer name
+		{"Conor McGregor", "Connor McGregor", 1 - 1.0/14},
+		{"Khabib Nurmagomedov", "Khabib Nurmagomedv", 1 - 1.0/18},
+		{"Conor McGregor", "Dustin Poirier", 0},
+		{"Jon Jones", "Jan Jines", 0.75},
+		{"Jon Jones", "Jan Jinas", 0},
+		// A blank name is like nothing
+		{"", "Conor McGregor", 0},
+		{" - ", " - ", 0},
+	}
+	for _, test := range tests {
+		if got := nameSimilarity(test.a, test.b); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("nameSimilarity(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	fighters := []*FighterStats{
+		{ID: "1", FirstName: "Conor", LastName: "McGregor", Birthdate: "7/14/1988 (36)"},
+		{ID: "2", FirstName: "Connor", LastName: "McGregor", Birthdate: "7/14/1988 (37)"},
+		// The same name born on another day, and another name born on the same day
+		{ID: "3", FirstName: "Conor", LastName: "McGregor", Birthdate: "1/1/1990"},
+		{ID: "4", FirstName: "Dustin", LastName: "Poirier", Birthdate: "7/14/1988"},
+		// A pair the alias table already merges
+		{ID: "5", FirstName: "Jose", LastName: "Aldo", Birthdate: "9/9/1986"},
+		{ID: "6", FirstName: "José", LastName: "Aldo", Birthdate: "9/9/1986"},
+		// Without a birthdate, nobody is paired
+		{ID: "7", FirstName: "Dustin", LastName: "Poirier"},
+		// An exact match sorts before the typo
+		{ID: "9", FirstName: "Max", LastName: "Holloway", Birthdate: "12/4/1991"},
+		{ID: "8", FirstName: "Max", LastName: "Holloway", Birthdate: "12/4/1991"},
+	}
+	aliases, err := newAliasTable([]fighterAlias{{ID: "5", IDs: []string{"6"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pairs := findDuplicates(fighters, aliases)
+	want := []struct{ a, b, birthdate string }{
+		{"8", "9", "12/4/1991"},
+		{"1", "2", "7/14/1988"},
+	}
+	if len(pairs) != len(want) {
+		t.Fatalf("%d pairs %+v, want %d", len(pairs), pairs, len(want))
+	}
+	for i, pair := range pairs {
+		if pair.A.ID != want[i].a || pair.B.ID != want[i].b || pair.Birthdate != want[i].birthdate {
+			t.Errorf("pair %d = %s-%s born %s, want %s-%s born %s", i, pair.A.ID, pair.B.ID, pair.Birthdate, want[i].a, want[i].b, want[i].birthdate)
+		}
+	}
+}
+
+// Pairs that share a fighter become one entry the alias table accepts
+func TestDuplicateAliasesGroupsPairs(t *testing.T) {
+	a := &FighterStats{ID: "1", FirstName: "Conor", LastName: "McGregor", Fights: make([]Fight, 3)}
+	b := &FighterStats{ID: "2", FirstName: "Connor", LastName: "McGregor", Fights: make([]Fight, 1)}
+	c := &FighterStats{ID: "3", FirstName: "Conor", LastName: "MacGregor"}
+	d := &FighterStats{ID: "4", FirstName: "Max", LastName: "Holloway"}
+	e := &FighterStats{ID: "5", FirstName: "Max", LastName: "Holloway", Fights: make([]Fight, 2)}
+	pairs := []duplicatePair{{A: b, B: c}, {A: d, B: e}, {A: a, B: b}}
+
+	entries := duplicateAliases(pairs)
+	if len(entries) != 2 {
+		t.Fatalf("%d entries %+v, want 2", len(entries), entries)
+	}
+	if got := entries[0]; got.ID != "1" || got.Name != "Conor McGregor" || !reflect.DeepEqual(got.Names, []string{"Connor McGregor", "Conor MacGregor"}) || !reflect.DeepEqual(got.IDs, []string{"2", "3"}) {
+		t.Errorf("entry %+v, want 1 with the names and IDs of 2 and 3", got)
+	}
+	// The same name isn't listed as another name
+	if got := entries[1]; got.ID != "5" || got.Names != nil || !reflect.DeepEqual(got.IDs, []string{"4"}) {
+		t.Errorf("entry %+v, want 5 with the ID of 4", got)
+	}
+	if _, err := newAliasTable(entries); err != nil {
+		t.Error(err)
+	}
+}
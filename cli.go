@@ -0,0 +1,432 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	espnHomeURL        = "https://www.espn.com/mma/"
+	espnFighterURL     = "https://www.espn.com/mma/fighter/"
+	espnFightCenterURL = "https://www.espn.com/mma/fightcenter/_/id/"
+)
+
+// Verbosity levels, set with -q and -v
+const (
+	quiet = iota
+	normal
+	verbose
+)
+
+var verbosity = normal
+
+// progressf prints a progress message unless -q was given. Progress goes to standard error,
+// so that the stdout sink's JSON can be piped.
+func progressf(format string, args ...interface{}) {
+	if verbosity >= normal {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// debugf logs a message only when -v was given
+func debugf(format string, args ...interface{}) {
+	if verbosity >= verbose {
+		log.Printf(format, args...)
+	}
+}
+
+// cliCommand is one subcommand of the scraper
+type cliCommand struct {
+	Name    string
+	Args    string // Positional arguments, for the usage line
+	Summary string
+	Run     func(args []string) error
+}
+
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{"crawl", "", "Crawl ESPN and write every fighter found to the sinks (the default)", runCrawlCommand},
+		{"fighter", "<id|url|name>", "Scrape a single fighter on demand", runFighterCommand},
+		{"event", "<id|url>", "Scrape the fighters on one event card", runEventCommand},
+		{"export", "<snapshot>", "Write a saved snapshot to the sinks without crawling", runExportCommand},
+		{"diff", "<old> <new>", "Compare two snapshots", runDiffCommand},
+		{"validate", "<snapshot>", "Check that a snapshot is well formed", runValidateCommand},
+		{"duplicates", "", "Report fighters in a snapshot who are likely the same person", runDuplicatesCommand},
+		{"search", "<name>", "Search a snapshot for fighters by name, nickname or alias", runSearchCommand},
+		{"serve", "", "Serve the scraped data over an HTTP query API", runServeCommand},
+		{"migrate", "", "Bring the database sinks' schemas up to date", runMigrateCommand},
+		{"schema", "", "Print the JSON Schema of fighters.json", runSchemaCommand},
+		{"config", "", "Check the settings and print where each one came from", runConfigCommand},
+	}
+}
+
+// runCLI runs the subcommand named by the first argument. Without one it crawls, like the
+// scraper always did.
+func runCLI(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" && args[0] != "--help" {
+		return runCrawlCommand(args)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return nil
+	}
+	for _, command := range cliCommands() {
+		if command.Name == args[0] {
+			return command.Run(args[1:])
+		}
+	}
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: mma-data-scraper <command> [flags] [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, command := range cliCommands() {
+		fmt.Fprintf(w, "  %-28s %s\n", strings.TrimSpace(command.Name+" "+command.Args), command.Summary)
+	}
+	fmt.Fprintln(w, "\nRun a command with -h to see its flags. Settings not covered by flags are read from MMA_* environment variables.")
+}
+
+// newCommandFlags creates the flag set of a command, with the config and verbosity flags every
+// command has
+func newCommandFlags(name, arguments string) (*flag.FlagSet, *commonFlags) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: mma-data-scraper %s\n", strings.TrimSpace(name+" [flags] "+arguments))
+		flags.PrintDefaults()
+	}
+	v := &commonFlags{}
+	flags.StringVar(&v.config, "config", "", "YAML or TOML config file (MMA_CONFIG, default mma.yaml or mma.toml if present)")
+	flags.BoolVar(&v.verbose, "v", false, "log every request")
+	flags.BoolVar(&v.quiet, "q", false, "only print warnings and errors")
+	return flags, v
+}
+
+// parseCommandFlags parses the flags and checks the number of positional arguments, then reads
+// the config file and checks every setting, so that a bad value fails before any work starts
+func parseCommandFlags(flags *flag.FlagSet, v *commonFlags, args []string, nargs int) error {
+	flags.Parse(args)
+	if flags.NArg() != nargs {
+		flags.Usage()
+		os.Exit(2)
+	}
+	switch {
+	case v.quiet:
+		verbosity = quiet
+	case v.verbose:
+		verbosity = verbose
+	}
+	if err := loadConfig(v.config); err != nil {
+		return err
+	}
+	return validateSettings()
+}
+
+type commonFlags struct {
+	config  string
+	verbose bool
+	quiet   bool
+}
+
+// sinkFlags are the flags of the commands that write fighters to sinks. They override the
+// environment variables of the same settings.
+type sinkFlags struct {
+	output      string
+	sinks       string
+	concurrency int
+}
+
+func addSinkFlags(flags *flag.FlagSet) *sinkFlags {
+	f := &sinkFlags{}
+	flags.StringVar(&f.output, "o", "", "path of the file sink's output (MMA_OUTPUT_FILE)")
+	flags.StringVar(&f.sinks, "sinks", "", "comma-separated sinks to write to (MMA_SINKS)")
+	flags.IntVar(&f.concurrency, "concurrency", 0, "concurrent requests per domain (MMA_CONCURRENCY)")
+	return f
+}
+
+// apply exports the flags that were given as the environment variables they override, so
+// that every loader reads its settings from one place
+func (f *sinkFlags) apply(defaultSinks string) {
+	if f.output != "" {
+		os.Setenv("MMA_OUTPUT_FILE", f.output)
+	}
+	if f.sinks != "" {
+		os.Setenv("MMA_SINKS", f.sinks)
+	} else if os.Getenv("MMA_SINKS") == "" && defaultSinks != "" {
+		os.Setenv("MMA_SINKS", defaultSinks)
+	}
+	if f.concurrency > 0 {
+		os.Setenv("MMA_CONCURRENCY", fmt.Sprint(f.concurrency))
+	}
+}
+
+func runCrawlCommand(args []string) error {
+	flags, v := newCommandFlags("crawl", "")
+	sinks := addSinkFlags(flags)
+	if err := parseCommandFlags(flags, v, args, 0); err != nil {
+		return err
+	}
+	sinks.apply("")
+
+	crawl(crawlScope{
+		StartURLs: seedURLs(),
+		Follow:    followAllLinks,
+		Whole:     true,
+	})
+	return nil
+}
+
+// runFighterCommand scrapes one fighter, fetching only their stats and history pages. The
+// result is printed unless other sinks are asked for, e.g. -sinks sqlite to upsert it.
+func runFighterCommand(args []string) error {
+	flags, v := newCommandFlags("fighter", "<id|url|name>")
+	sinks := addSinkFlags(flags)
+	if err := parseCommandFlags(flags, v, args, 1); err != nil {
+		return err
+	}
+	sinks.apply("stdout")
+
+	start := time.Now()
+	client, err := newFighterClient()
+	if err != nil {
+		return err
+	}
+	id, slug, err := resolveFighter(client, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// The API source has its own client and pages
+	if source := os.Getenv("MMA_SOURCE"); source != "" && source != "html" {
+		crawl(crawlScope{AthleteIDs: []string{id}})
+		return nil
+	}
+
+	fighter, err := scrapeFighter(client, id, slug)
+	if err != nil {
+		return err
+	}
+	aliases, err := loadAliasTable()
+	if err != nil {
+		return fmt.Errorf("reading aliases: %v", err)
+	}
+	aliases.resolve("", fighter)
+	for _, issue := range checkFighter(fighter) {
+		log.Printf("Quality issue: %s", issue)
+	}
+	run := newRunInfo(start, outputSource{Name: "html", URL: fighterPageURLs(id, slug)[0]})
+	outputs, err := loadSinks(run)
+	if err != nil {
+		return err
+	}
+	writeToSinks(outputs, []FighterStats{*fighter})
+	progressf("Scraped %s %s in %s\n", fighter.FirstName, fighter.LastName, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// runEventCommand scrapes the fighters on an event card. The result is printed unless other
+// sinks are asked for.
+func runEventCommand(args []string) error {
+	flags, v := newCommandFlags("event", "<id|url>")
+	sinks := addSinkFlags(flags)
+	if err := parseCommandFlags(flags, v, args, 1); err != nil {
+		return err
+	}
+	sinks.apply("stdout")
+
+	if source := os.Getenv("MMA_SOURCE"); source != "" && source != "html" {
+		return fmt.Errorf("the event command needs the html source, not %s", source)
+	}
+	eventURL, err := parseEventRef(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	crawl(crawlScope{
+		StartURLs: []string{eventURL},
+		Follow: func(pageURL, link string) []string {
+			// Only the fighters linked from the card itself, straight to their stats and history
+			if pageURL != eventURL {
+				return nil
+			}
+			id, slug, err := parseFighterRef(link)
+			if err != nil {
+				return nil
+			}
+			return fighterPageURLs(id, slug)
+		},
+	})
+	return nil
+}
+
+// runExportCommand writes a snapshot to the sinks, e.g. to turn fighters.json into CSV files
+func runExportCommand(args []string) error {
+	flags, v := newCommandFlags("export", "<snapshot>")
+	sinks := addSinkFlags(flags)
+	if err := parseCommandFlags(flags, v, args, 1); err != nil {
+		return err
+	}
+	sinks.apply("")
+
+	snapshot, err := loadSnapshot(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", flags.Arg(0), err)
+	}
+
+	// Keep the run the snapshot came from, when it says
+	source := snapshot.Source
+	if source.Name == "" {
+		source = outputSource{Name: "snapshot", URL: flags.Arg(0)}
+	}
+	run := newRunInfo(time.Now(), source)
+	if snapshot.RunID != "" {
+		run.ID = snapshot.RunID
+	}
+	run.Politeness = snapshot.Politeness
+
+	outputs, err := loadSinks(run)
+	if err != nil {
+		return err
+	}
+	writeToSinks(outputs, snapshot.Fighters)
+	return nil
+}
+
+func runMigrateCommand(args []string) error {
+	flags, v := newCommandFlags("migrate", "")
+	sinks := addSinkFlags(flags)
+	if err := parseCommandFlags(flags, v, args, 0); err != nil {
+		return err
+	}
+	sinks.apply("")
+
+	outputs, err := loadSinks(newRunInfo(time.Now(), outputSource{}))
+	if err != nil {
+		return err
+	}
+	for _, sink := range outputs {
+		if m, ok := sink.(migrator); ok {
+			if err := m.Migrate(); err != nil {
+				return fmt.Errorf("migrating %s: %v", sink.Name(), err)
+			}
+			progressf("Migrated %s\n", sink.Name())
+		}
+	}
+	return nil
+}
+
+func runSchemaCommand(args []string) error {
+	flags, v := newCommandFlags("schema", "")
+	if err := parseCommandFlags(flags, v, args, 0); err != nil {
+		return err
+	}
+	return writeOutputJSONSchema(os.Stdout)
+}
+
+// runConfigCommand prints every setting after the config file, environment and defaults are
+// combined. Settings are checked while the flags are parsed, so it fails on a bad value.
+func runConfigCommand(args []string) error {
+	flags, v := newCommandFlags("config", "")
+	if err := parseCommandFlags(flags, v, args, 0); err != nil {
+		return err
+	}
+	writeSettings(os.Stdout)
+	return nil
+}
+
+// crawlScope says where a crawl starts and which links it follows
+type crawlScope struct {
+	StartURLs  []string // HTML pages to start from
+	AthleteIDs []string // Fighters the API source starts from; the scoreboard when empty
+
+	// Follow returns the pages to visit for a link found on a page; nil follows nothing
+	Follow func(pageURL, link string) []string
+
+	// Whole is set for a crawl of the whole site. Only those are compared with the previous
+	// run for the webhooks, since a partial crawl would report everyone else as removed, and
+	// only those write the quality report.
+	Whole bool
+}
+
+// seedURLs are the pages a crawl starts from, MMA_SEED_URLS (comma-separated) or ESPN's MMA home
+// page
+func seedURLs() []string {
+	var urls []string
+	for _, seed := range strings.Split(os.Getenv("MMA_SEED_URLS"), ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			urls = append(urls, seed)
+		}
+	}
+	if len(urls) == 0 {
+		return []string{espnHomeURL}
+	}
+	return urls
+}
+
+func followAllLinks(pageURL, link string) []string {
+	if shouldVisitURL(link) {
+		return []string{link}
+	}
+	return nil
+}
+
+// parseFighterRef accepts an ESPN athlete ID or any fighter page URL, and returns the ID and
+// the name slug of the URL, if any
+func parseFighterRef(ref string) (string, string, error) {
+	if isDigits(ref) {
+		return ref, "", nil
+	}
+	u, err := url.Parse(ref)
+	if err != nil || !strings.Contains(u.Path, "/mma/fighter/") {
+		return "", "", fmt.Errorf("%q is not an ESPN fighter ID or URL", ref)
+	}
+	id := fighterIDFromURL(u.Path)
+	if id == "" {
+		return "", "", fmt.Errorf("no fighter ID in %q", ref)
+	}
+	slug := ""
+	if parts := strings.Split(strings.TrimSuffix(u.Path, "/"), "/"); parts[len(parts)-1] != id {
+		slug = parts[len(parts)-1]
+	}
+	return id, slug, nil
+}
+
+// fighterPageURLs returns the stats and fight history pages of a fighter
+func fighterPageURLs(id, slug string) []string {
+	suffix := "/_/id/" + id
+	if slug != "" {
+		suffix += "/" + slug
+	}
+	return []string{espnFighterURL + "stats" + suffix, espnFighterURL + "history" + suffix}
+}
+
+// parseEventRef accepts an ESPN event ID or fight center URL and returns the URL
+func parseEventRef(ref string) (string, error) {
+	if isDigits(ref) {
+		return espnFightCenterURL + ref, nil
+	}
+	u, err := url.Parse(ref)
+	if err != nil || !strings.Contains(u.Host, "espn.com") || !strings.Contains(u.Path, "/mma/fightcenter") {
+		return "", fmt.Errorf("%q is not an ESPN event ID or fight center URL", ref)
+	}
+	return ref, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+)
+
+// stringColumns lists the JSON names and values of the string fields of a struct, in field
+// order, leaving out the names in skip. Sinks use it to turn the stats structs into table rows.
+func stringColumns(v interface{}, skip ...string) ([]string, []interface{}) {
+	rv := reflect.ValueOf(v)
+	rt := rv.Type()
+
+	var names []string
+	var values []interface{}
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.Type.Kind() != reflect.String {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || containsString(skip, name) {
+			continue
+		}
+		names = append(names, name)
+		values = append(values, rv.Field(i).String())
+	}
+	return names, values
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setStringColumns is the reverse of stringColumns: it sets the string fields of the struct
+// that ptr points to from their JSON names. Names without a matching field are ignored.
+func setStringColumns(ptr interface{}, names []string, values []string) {
+	rv := reflect.ValueOf(ptr).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.Type.Kind() != reflect.String {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		for j, column := range names {
+			if column == name {
+				rv.Field(i).SetString(values[j])
+			}
+		}
+	}
+}
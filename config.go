@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFiles are read, the first that exists, when neither -config nor MMA_CONFIG names
+// a config file
+var defaultConfigFiles = []string{"mma.yaml", "mma.yml", "mma.toml"}
+
+// configSetting is one setting of the scraper: its key in a config file, the environment
+// variable that overrides it, and how its value is checked at startup
+type configSetting struct {
+	Key         string // Dotted path in the config file, e.g. crawl.min_delay
+	Env         string
+	Description string
+	Check       func(value string) error
+	Map         bool // The config file may give a map, written as Name=Value,Name=Value
+}
+
+// configSettings lists every setting, in the order `config` prints them
+var configSettings = []configSetting{
+	{"source", "MMA_SOURCE", "Where fighters come from: html or api", checkChoice("html", "api"), false},
+	{"sinks", "MMA_SINKS", "Where fighters are written (default file)", checkChoices(sinkNames...), false},
+	{"output_file", "MMA_OUTPUT_FILE", "Path of the file sink (default fighters.json)", nil, false},
+	{"quality_report", "MMA_QUALITY_REPORT", "Where each crawl writes its data quality report (default quality_report.json)", nil, false},
+	{"quarantine_dir", "MMA_QUARANTINE_DIR", "Where pages that failed to parse or had empty tables are saved, or off (default quarantine)", nil, false},
+	{"search_url", "MMA_SEARCH_URL", "ESPN search endpoint for fighter names, the name is appended", checkURL, false},
+
+	{"crawl.seed_urls", "MMA_SEED_URLS", "Pages a crawl starts from (default the ESPN MMA home page)", checkURLs, false},
+	{"crawl.polite", "MMA_POLITE", "Respect robots.txt with conservative delays", checkBool, false},
+	{"crawl.concurrency", "MMA_CONCURRENCY", "Concurrent requests per domain (default 8)", checkInt(1), false},
+	{"crawl.min_delay", "MMA_MIN_DELAY", "Delay after each request", checkDuration, false},
+	{"crawl.random_delay", "MMA_RANDOM_DELAY", "Random extra delay of up to this long (default 4s)", checkDuration, false},
+	{"crawl.max_requests_per_hour", "MMA_MAX_REQUESTS_PER_HOUR", "Request budget per rolling hour, 0 for none", checkInt(0), false},
+	{"crawl.proxies", "MMA_PROXIES", "Proxy URLs, or off to connect directly", checkProxies, false},
+	{"crawl.proxy_file", "MMA_PROXY_FILE", "File of proxy URLs, one per line (default proxies.txt)", nil, false},
+	{"crawl.proxy_max_failures", "MMA_PROXY_MAX_FAILURES", "Failures in a row that take a proxy out of the rotation (default 3)", checkInt(1), false},
+	{"crawl.proxy_eject_for", "MMA_PROXY_EJECT_FOR", "How long a failing proxy is left out (default 10m)", checkDuration, false},
+	{"crawl.profile_file", "MMA_PROFILE_FILE", "JSON file of browser profiles (default profiles.json)", nil, false},
+	{"crawl.alias_file", "MMA_ALIAS_FILE", "JSON file of fighter aliases (default aliases.json)", nil, false},
+
+	{"retry.attempts", "MMA_RETRY_ATTEMPTS", "Attempts per URL before giving up (default 5)", checkInt(1), false},
+	{"retry.base_delay", "MMA_RETRY_BASE_DELAY", "Delay before the first retry, doubled every attempt (default 30s)", checkDuration, false},
+	{"retry.max_delay", "MMA_RETRY_MAX_DELAY", "Longest delay between retries (default 10m)", checkDuration, false},
+	{"retry.breaker_threshold", "MMA_BREAKER_THRESHOLD", "Share of recent responses that are bans which pauses the crawl (default 0.5)", checkFraction, false},
+	{"retry.breaker_window", "MMA_BREAKER_WINDOW", "Recent responses the ban share is taken over (default 20)", checkInt(1), false},
+	{"retry.breaker_cooldown", "MMA_BREAKER_COOLDOWN", "How long the crawl pauses once the share is crossed (default 5m)", checkDuration, false},
+
+	{"api.base_url", "MMA_API_BASE_URL", "Base URL of the ESPN API source", checkURL, false},
+	{"api.scoreboard_url", "MMA_API_SCOREBOARD_URL", "Scoreboard the API source starts from", checkURL, false},
+	{"api.dates", "MMA_API_DATES", "Scoreboard dates, e.g. 2024 or 20240101-20240630", checkAPIDates, false},
+
+	{"ndjson.file", "MMA_NDJSON_FILE", "Path of the NDJSON sink (default fighters.ndjson)", nil, false},
+	{"sqlite.path", "MMA_SQLITE_PATH", "Database of the SQLite sink (default fighters.db)", nil, false},
+	{"postgres.url", "MMA_POSTGRES_URL", "Database of the PostgreSQL sink", checkURL, false},
+	{"csv.dir", "MMA_CSV_DIR", "Directory of the CSV sink (default csv)", nil, false},
+	{"parquet.dir", "MMA_PARQUET_DIR", "Directory of the Parquet sink (default parquet)", nil, false},
+
+	{"http_sink.url", "MMA_HTTP_SINK_URL", "Where the HTTP sink uploads fighters", checkURL, false},
+	{"http_sink.token", "MMA_HTTP_SINK_TOKEN", "Bearer token of the HTTP sink", nil, false},
+	{"http_sink.headers", "MMA_HTTP_SINK_HEADERS", "Extra headers of the HTTP sink", checkHeaders, true},
+	{"http_sink.batch_size", "MMA_HTTP_SINK_BATCH_SIZE", "Fighters per request (default 100)", checkInt(1), false},
+
+	{"serve.addr", "MMA_SERVE_ADDR", "Address the query API listens on (default :8080)", nil, false},
+	{"serve.data", "MMA_SERVE_DATA", "Snapshot the query API serves (default the store the sinks write)", nil, false},
+	{"serve.reload", "MMA_SERVE_RELOAD", "How often the query API reloads its data (default 5m)", checkDuration, false},
+
+	{"webhooks.urls", "MMA_WEBHOOK_URLS", "Webhooks sent the changes of each run", checkURLs, false},
+	{"webhooks.secret", "MMA_WEBHOOK_SECRET", "Key the webhook deliveries are signed with", nil, false},
+	{"webhooks.events", "MMA_WEBHOOK_EVENTS", "Event types sent to the webhooks (default all)", checkChoices(allChangeEvents...), false},
+	{"webhooks.baseline", "MMA_WEBHOOK_BASELINE", "Snapshot of the previous run (default the file sink's output)", nil, false},
+}
+
+var sinkNames = []string{"file", "http", "ndjson", "stdout", "csv", "parquet", "sqlite", "postgres"}
+
+// configOrigins records the settings that were taken from the config file, for `config`
+var configOrigins = make(map[string]string)
+
+// loadConfig reads the config file and exports its settings as the environment variables they
+// correspond to. Variables that are already set win, and flags override both, so a config file
+// can be shared between environments that only differ in a few variables. path is the -config
+// flag; without it MMA_CONFIG is used, then the first of mma.yaml, mma.yml and mma.toml that
+// exists.
+func loadConfig(path string) error {
+	if path == "" {
+		path = os.Getenv("MMA_CONFIG")
+	}
+	if path == "" {
+		for _, name := range defaultConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil
+	}
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	for _, setting := range configSettings {
+		value, ok := values[setting.Key]
+		if !ok {
+			continue
+		}
+		if _, set := os.LookupEnv(setting.Env); set {
+			continue
+		}
+		os.Setenv(setting.Env, value)
+		configOrigins[setting.Env] = path
+	}
+	debugf("Read settings from %s\n", path)
+	return nil
+}
+
+// readConfigFile parses a YAML or TOML config file, picked by its extension, into the values of
+// the settings it sets. Unknown keys are an error, so a typo doesn't silently do nothing.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	document := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown config file format, expected .yaml, .yml or .toml", path)
+	}
+
+	values := make(map[string]string)
+	var problems []string
+	flattenConfig(document, "", values, &problems)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return values, nil
+}
+
+// flattenConfig turns nested sections into dotted keys and every value into the string its
+// environment variable would hold. Lists are joined with commas.
+func flattenConfig(section map[string]interface{}, prefix string, values map[string]string, problems *[]string) {
+	for _, key := range sortedKeys(section) {
+		path := prefix + key
+		setting := findConfigSetting(path)
+		switch value := section[key].(type) {
+		case map[string]interface{}:
+			if setting != nil && setting.Map {
+				var pairs []string
+				for _, name := range sortedKeys(value) {
+					pairs = append(pairs, name+"="+fmt.Sprint(value[name]))
+				}
+				values[path] = strings.Join(pairs, ",")
+				continue
+			}
+			if setting != nil {
+				*problems = append(*problems, fmt.Sprintf("%s: expected a value, not a section", path))
+				continue
+			}
+			flattenConfig(value, path+".", values, problems)
+		case []interface{}:
+			if setting == nil {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown setting", path))
+				continue
+			}
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[path] = strings.Join(items, ",")
+		case nil:
+			// An empty key leaves the default
+		default:
+			if setting == nil {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown setting", path))
+				continue
+			}
+			values[path] = fmt.Sprint(value)
+		}
+	}
+}
+
+func findConfigSetting(key string) *configSetting {
+	for i := range configSettings {
+		if configSettings[i].Key == key {
+			return &configSettings[i]
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateSettings checks every setting that is set, wherever it came from, and reports all
+// the problems at once
+func validateSettings() error {
+	var problems []string
+	for _, setting := range configSettings {
+		value := os.Getenv(setting.Env)
+		if value == "" || setting.Check == nil {
+			continue
+		}
+		if err := setting.Check(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s, from %s): %v", setting.Env, setting.Key, settingOrigin(setting.Env), err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid settings:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// settingOrigin says where the value of an environment variable came from
+func settingOrigin(env string) string {
+	if path, ok := configOrigins[env]; ok {
+		return path
+	}
+	if os.Getenv(env) == "" {
+		return "default"
+	}
+	return "environment"
+}
+
+func checkInt(min int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		if n < min {
+			return fmt.Errorf("%d is less than %d", n, min)
+		}
+		return nil
+	}
+}
+
+// checkFraction accepts a share above 0 and up to 1
+func checkFraction(value string) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", value)
+	}
+	if f <= 0 || f > 1 {
+		return fmt.Errorf("%s is not above 0 and at most 1", value)
+	}
+	return nil
+}
+
+func checkBool(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("%q is not true or false", value)
+	}
+	return nil
+}
+
+func checkDuration(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as 10s or 5m", value)
+	}
+	if d < 0 {
+		return fmt.Errorf("%s is negative", value)
+	}
+	return nil
+}
+
+func checkURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", value)
+	}
+	return nil
+}
+
+func checkURLs(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			if err := checkURL(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkProxies(value string) error {
+	if strings.EqualFold(strings.TrimSpace(value), "off") {
+		return nil
+	}
+	return checkURLs(value)
+}
+
+func checkChoice(choices ...string) func(string) error {
+	return func(value string) error {
+		if !containsString(choices, value) {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(choices, ", "))
+		}
+		return nil
+	}
+}
+
+func checkChoices(choices ...string) func(string) error {
+	check := checkChoice(choices...)
+	return func(value string) error {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				if err := check(item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func checkHeaders(value string) error {
+	_, err := parseHeaderList(value)
+	return err
+}
+
+// checkAPIDates accepts the scoreboard's dates parameter: a year, a day, or a range of either
+func checkAPIDates(value string) error {
+	for _, part := range strings.SplitN(value, "-", 2) {
+		if !isDigits(part) || len(part) != 4 && len(part) != 8 {
+			return fmt.Errorf("%q is not a year or day such as 2024, 20240101 or 20240101-20240630", value)
+		}
+	}
+	return nil
+}
+
+// writeSettings prints every setting with its value and where the value came from, and with -v
+// what it does. Secrets are masked.
+func writeSettings(w io.Writer) {
+	for _, setting := range configSettings {
+		value := redactSetting(setting.Env, os.Getenv(setting.Env))
+		fmt.Fprintf(w, "%-28s %-26s %-18s %s\n", setting.Key, setting.Env, settingOrigin(setting.Env), value)
+		if verbosity >= verbose {
+			fmt.Fprintf(w, "    %s\n", setting.Description)
+		}
+	}
+}
+
+// redactSetting masks tokens and secrets, and the passwords of URLs. Settings such as
+// MMA_PROXIES hold a comma-separated list of URLs, so each item is redacted on its own.
+func redactSetting(env, value string) string {
+	if value != "" && (strings.HasSuffix(env, "_TOKEN") || strings.HasSuffix(env, "_SECRET")) {
+		return "********"
+	}
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		if u, err := url.Parse(strings.TrimSpace(item)); err == nil && u.User != nil {
+			items[i] = u.Redacted()
+		}
+	}
+	return strings.Join(items, ",")
+}
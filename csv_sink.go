@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultCSVDir = "csv"
+
+// csvSink flattens the fighters into one CSV file per table. Every file starts with a
+// fighter_id column, so the files can be joined on it in a spreadsheet or notebook.
+type csvSink struct {
+	Dir string
+}
+
+// csvColumnDescriptions documents the CSV headers. The descriptions are written to
+// COLUMNS.md next to the CSV files.
+var csvColumnDescriptions = map[string]string{
+	"fighter_id":        "ESPN athlete ID, or the fighter's name when the ID is unknown",
+	"position":          "Order of the row on ESPN, 0 being the most recent fight",
+	"first_name":        "First name",
+	"last_name":         "Last name",
+	"height_and_weight": "Height and weight as shown by ESPN, e.g. 5' 9\", 155 lbs",
+	"birthdate":         "Birthdate as shown by ESPN",
+	"team":              "Team or gym",
+	"nickname":          "Nickname",
+	"stance":            "Stance, e.g. Orthodox or Southpaw",
+	"win_loss_record":   "Wins-losses-draws",
+	"tko_record":        "(T)KO wins-losses",
+	"sub_record":        "Submission wins-losses",
+	"date":              "Date of the fight",
+	"opponent":          "Opponent's name",
+	"event":             "Event name",
+	"result":            "Result for this fighter, e.g. W or L",
+	"decision":          "How the fight ended, e.g. KO/TKO or Decision - Unanimous",
+	"rnd":               "Round the fight ended in",
+	"time":              "Time in the final round",
+	"sdbl_a":            "Significant distance body strikes landed/attempted",
+	"sdhl_a":            "Significant distance head strikes landed/attempted",
+	"sdll_a":            "Significant distance leg strikes landed/attempted",
+	"tsl":               "Total strikes landed",
+	"tsa":               "Total strikes attempted",
+	"ssl":               "Significant strikes landed",
+	"ssa":               "Significant strikes attempted",
+	"tsl_tsa":           "Total strikes landed/attempted percentage",
+	"kd":                "Knockdowns",
+	"percent_body":      "Share of significant strikes to the body",
+	"percent_head":      "Share of significant strikes to the head",
+	"percent_leg":       "Share of significant strikes to the legs",
+	"scbl":              "Significant clinch body strikes landed",
+	"scba":              "Significant clinch body strikes attempted",
+	"schl":              "Significant clinch head strikes landed",
+	"scha":              "Significant clinch head strikes attempted",
+	"scll":              "Significant clinch leg strikes landed",
+	"scla":              "Significant clinch leg strikes attempted",
+	"rv":                "Reversals",
+	"sr":                "Slam rate",
+	"tdl":               "Takedowns landed",
+	"tda":               "Takedowns attempted",
+	"tds":               "Takedown slams",
+	"tk_acc":            "Takedown accuracy",
+	"sgbl":              "Significant ground body strikes landed",
+	"sgba":              "Significant ground body strikes attempted",
+	"sghl":              "Significant ground head strikes landed",
+	"sgha":              "Significant ground head strikes attempted",
+	"sgll":              "Significant ground leg strikes landed",
+	"sgla":              "Significant ground leg strikes attempted",
+	"ad":                "Advances",
+	"adtb":              "Advances to back",
+	"adhg":              "Advances to half guard",
+	"adtm":              "Advances to mount",
+	"adts":              "Advances to side control",
+	"sm":                "Submission attempts",
+}
+
+// csvTable is one CSV file being built
+type csvTable struct {
+	file   string
+	header []string
+	rows   [][]string
+}
+
+func (s *csvSink) Name() string {
+	return "csv " + s.Dir
+}
+
+func (s *csvSink) Write(fighters []FighterStats) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	// The headers come from the zero values, so files are consistent even when empty
+	tables := []*csvTable{
+		{file: "fighters.csv", header: csvHeader(FighterStats{}, false)},
+		{file: "fights.csv", header: csvHeader(Fight{}, true)},
+		{file: "striking.csv", header: csvHeader(StrikingStats{}, true)},
+		{file: "clinch.csv", header: csvHeader(ClinchStats{}, true)},
+		{file: "ground.csv", header: csvHeader(GroundStats{}, true)},
+	}
+
+	for i := range fighters {
+		fighter := &fighters[i]
+		id := fighterID(fighter)
+
+		tables[0].rows = append(tables[0].rows, csvRow(id, -1, *fighter))
+		for position, fight := range fighter.Fights {
+			tables[1].rows = append(tables[1].rows, csvRow(id, position, fight))
+		}
+		for position, stats := range fighter.StrikingStats {
+			tables[2].rows = append(tables[2].rows, csvRow(id, position, stats))
+		}
+		for position, stats := range fighter.ClinchStats {
+			tables[3].rows = append(tables[3].rows, csvRow(id, position, stats))
+		}
+		for position, stats := range fighter.GroundStats {
+			tables[4].rows = append(tables[4].rows, csvRow(id, position, stats))
+		}
+	}
+
+	for _, table := range tables {
+		if err := writeCSVFile(filepath.Join(s.Dir, table.file), table.header, table.rows); err != nil {
+			return err
+		}
+	}
+	return writeCSVColumnDocs(filepath.Join(s.Dir, "COLUMNS.md"), tables)
+}
+
+// csvHeader builds the header of a table; per-fight tables get a position column
+func csvHeader(v interface{}, perFight bool) []string {
+	columns, _ := stringColumns(v, "id")
+	header := []string{"fighter_id"}
+	if perFight {
+		header = append(header, "position")
+	}
+	return append(header, columns...)
+}
+
+// csvRow builds a row to match csvHeader; a negative position leaves the position column out
+func csvRow(fighterID string, position int, v interface{}) []string {
+	_, values := stringColumns(v, "id")
+	row := []string{fighterID}
+	if position >= 0 {
+		row = append(row, strconv.Itoa(position))
+	}
+	for _, value := range values {
+		row = append(row, value.(string))
+	}
+	return row
+}
+
+// Helper function to write a CSV file with a header row
+func writeCSVFile(path string, header []string, rows [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Helper function to write the column documentation for the CSV files
+func writeCSVColumnDocs(path string, tables []*csvTable) error {
+	var b strings.Builder
+	b.WriteString("# CSV columns\n\n")
+	b.WriteString("Every file starts with `fighter_id`, which joins the per-fight files to `fighters.csv`.\n")
+	for _, table := range tables {
+		fmt.Fprintf(&b, "\n## %s\n\n", table.file)
+		b.WriteString("| Column | Description |\n| --- | --- |\n")
+		for _, column := range table.header {
+			fmt.Fprintf(&b, "| `%s` | %s |\n", column, csvColumnDescriptions[column])
+		}
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readCSVFile returns the header and rows of a CSV file
+func readCSVFile(t *testing.T, path string) ([]string, [][]string) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 {
+		t.Fatalf("%s has no header", path)
+	}
+	return records[0], records[1:]
+}
+
+func TestCSVSinkTables(t *testing.T) {
+	dir := t.TempDir()
+	fighters := sqlTestFighters()
+	// A fighter without an ID is keyed by name in every table
+	fighters = append(fighters, FighterStats{FirstName: "Test", LastName: "Fighter", Fights: []Fight{{Date: "Jan 1, 2024", Opponent: "Someone"}}})
+	if err := (&csvSink{Dir: dir}).Write(fighters); err != nil {
+		t.Fatal(err)
+	}
+
+	header, rows := readCSVFile(t, filepath.Join(dir, "fighters.csv"))
+	wantHeader := []string{"fighter_id", "first_name", "last_name", "height_and_weight", "birthdate", "team", "nickname", "stance", "win_loss_record", "tko_record", "sub_record"}
+	if !reflect.DeepEqual(header, wantHeader) {
+		t.Errorf("fighters.csv header %q, want %q", header, wantHeader)
+	}
+	ids := make(map[string]bool)
+	for _, row := range rows {
+		ids[row[0]] = true
+	}
+	if !reflect.DeepEqual(ids, map[string]bool{"3022677": true, "2335639": true, "test fighter": true}) {
+		t.Errorf("fighter IDs %v", ids)
+	}
+	if rows[0][1] != "Conor" || rows[0][2] != "McGregor" {
+		t.Errorf("first row %q, want Conor McGregor's", rows[0])
+	}
+
+	// Every per-fight table has the fighter key and the row's position before its columns,
+	// and each row belongs to a fighter in fighters.csv
+	for _, table := range []struct {
+		file    string
+		columns []string
+		rows    int
+	}{
+		{"fights.csv", []string{"date", "opponent", "event", "result", "decision", "rnd", "time"}, 3},
+		{"striking.csv", csvHeader(StrikingStats{}, false)[1:], 1},
+		{"clinch.csv", csvHeader(ClinchStats{}, false)[1:], 1},
+		{"ground.csv", csvHeader(GroundStats{}, false)[1:], 1},
+	} {
+		header, rows := readCSVFile(t, filepath.Join(dir, table.file))
+		if want := append([]string{"fighter_id", "position"}, table.columns...); !reflect.DeepEqual(header, want) {
+			t.Errorf("%s header %q, want %q", table.file, header, want)
+		}
+		if len(rows) != table.rows {
+			t.Errorf("%s has %d rows, want %d", table.file, len(rows), table.rows)
+		}
+		for _, row := range rows {
+			if len(row) != len(header) {
+				t.Errorf("%s row %q has %d columns, want %d", table.file, row, len(row), len(header))
+			}
+			if !ids[row[0]] {
+				t.Errorf("%s row %q has a fighter_id that isn't in fighters.csv", table.file, row)
+			}
+		}
+	}
+	if _, rows := readCSVFile(t, filepath.Join(dir, "fights.csv")); rows[0][0] != "3022677" || rows[0][1] != "0" || rows[0][3] != "Dustin Poirier" {
+		t.Errorf("first fight %q, want McGregor's fight 0 against Poirier", rows[0])
+	}
+}
+
+// With no fighters every file still gets its header
+func TestCSVSinkEmpty(t *testing.T) {
+	dir := t.TempDir()
+	if err := (&csvSink{Dir: dir}).Write(nil); err != nil {
+		t.Fatal(err)
+	}
+	header, rows := readCSVFile(t, filepath.Join(dir, "striking.csv"))
+	if len(rows) != 0 || !reflect.DeepEqual(header, csvHeader(StrikingStats{}, true)) {
+		t.Errorf("striking.csv header %q and %d rows", header, len(rows))
+	}
+}
+
+// COLUMNS.md documents every column of every file
+func TestCSVColumnDocs(t *testing.T) {
+	dir := t.TempDir()
+	if err := (&csvSink{Dir: dir}).Write(nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "COLUMNS.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := string(data)
+	for _, table := range []struct {
+		file   string
+		header []string
+	}{
+		{"fighters.csv", csvHeader(FighterStats{}, false)},
+		{"fights.csv", csvHeader(Fight{}, true)},
+		{"striking.csv", csvHeader(StrikingStats{}, true)},
+		{"clinch.csv", csvHeader(ClinchStats{}, true)},
+		{"ground.csv", csvHeader(GroundStats{}, true)},
+	} {
+		i := strings.Index(docs, "## "+table.file+"\n")
+		if i < 0 {
+			t.Errorf("COLUMNS.md has no section for %s", table.file)
+			continue
+		}
+		section := docs[i:]
+		if end := strings.Index(section[3:], "## "); end >= 0 {
+			section = section[:end+3]
+		}
+		for _, column := range table.header {
+			description := csvColumnDescriptions[column]
+			if description == "" {
+				t.Errorf("%s column %s has no description", table.file, column)
+			}
+			if row := "| `" + column + "` | " + description + " |\n"; !strings.Contains(section, row) {
+				t.Errorf("COLUMNS.md section for %s has no row %q", table.file, row)
+			}
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// datasetDiff is what changed between two snapshots of the fighters
+type datasetDiff struct {
+	Old             snapshotSummary `json:"old"`
+	New             snapshotSummary `json:"new"`
+	NewFighters     []diffFighter   `json:"new_fighters"`
+	RemovedFighters []diffFighter   `json:"removed_fighters"`
+	NewFights       []diffFight     `json:"new_fights"`
+	ChangedRecords  []diffChange    `json:"changed_records"`
+	ChangedBio      []diffChange    `json:"changed_bio"`
+	CorrectedStats  []diffChange    `json:"corrected_stats"`
+}
+
+// snapshotSummary describes one side of a diff
+type snapshotSummary struct {
+	Source   string `json:"source"`
+	RunID    string `json:"run_id,omitempty"`
+	Fighters int    `json:"fighters"`
+}
+
+type diffFighter struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type diffFight struct {
+	FighterID string `json:"fighter_id"`
+	Name      string `json:"name"`
+	Date      string `json:"date"`
+	Opponent  string `json:"opponent"`
+	Event     string `json:"event"`
+	Result    string `json:"result"`
+}
+
+// diffChange is one field that has a different value in the new snapshot. Table, Date and
+// Opponent are only set for per-fight rows.
+type diffChange struct {
+	FighterID string `json:"fighter_id"`
+	Name      string `json:"name"`
+	Table     string `json:"table,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Opponent  string `json:"opponent,omitempty"`
+	Field     string `json:"field"`
+	Old       string `json:"old"`
+	New       string `json:"new"`
+}
+
+// The record fields are reported separately from the rest of the bio
+var recordFields = []string{"win_loss_record", "tko_record", "sub_record"}
+
+// runDiffCommand implements "diff [-json FILE] OLD NEW". OLD and NEW are JSON or NDJSON output
+// files, SQLite databases or PostgreSQL URLs. The summary is printed to standard output, and
+// -json also writes the diff as JSON ("-" prints the JSON instead of the summary).
+func runDiffCommand(args []string) error {
+	flags, v := newCommandFlags("diff", "<old> <new>")
+	jsonPath := flags.String("json", "", "also write the diff as JSON to this file, or - for standard output")
+	if err := parseCommandFlags(flags, v, args, 2); err != nil {
+		return err
+	}
+
+	oldSnapshot, err := loadSnapshot(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", flags.Arg(0), err)
+	}
+	newSnapshot, err := loadSnapshot(flags.Arg(1))
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", flags.Arg(1), err)
+	}
+
+	diff := diffDatasets(oldSnapshot.Fighters, newSnapshot.Fighters)
+	diff.Old = snapshotSummary{Source: flags.Arg(0), RunID: oldSnapshot.RunID, Fighters: len(oldSnapshot.Fighters)}
+	diff.New = snapshotSummary{Source: flags.Arg(1), RunID: newSnapshot.RunID, Fighters: len(newSnapshot.Fighters)}
+
+	if *jsonPath != "" {
+		jsonData, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		if *jsonPath == "-" {
+			_, err = os.Stdout.Write(append(jsonData, '\n'))
+			return err
+		}
+		if err := ioutil.WriteFile(*jsonPath, jsonData, 0644); err != nil {
+			return err
+		}
+	}
+	writeDiffSummary(os.Stdout, &diff)
+	return nil
+}
+
+// loadSnapshot reads the fighters from an output file or a database written by a sink
+func loadSnapshot(source string) (*outputEnvelope, error) {
+	if strings.HasPrefix(source, "postgres://") || strings.HasPrefix(source, "postgresql://") {
+		return loadSQLSnapshot("postgres", source)
+	}
+
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".db", ".sqlite", ".sqlite3":
+		if _, err := os.Stat(source); err != nil {
+			return nil, err
+		}
+		return loadSQLSnapshot("sqlite3", readOnlySQLite(source))
+	case ".ndjson", ".jsonl":
+		return loadNDJSONSnapshot(source)
+	}
+	return readOutputFile(source)
+}
+
+// readOnlySQLite is the data source that opens a SQLite file read-only. go-sqlite3 only reads
+// the mode parameter from a file: URI; after a plain path it is ignored. The path is escaped,
+// so a ? or # in it isn't taken for the start of the query or fragment.
+func readOnlySQLite(path string) string {
+	return (&url.URL{Scheme: "file", OmitHost: true, Path: path, RawQuery: "mode=ro"}).String()
+}
+
+func loadSQLSnapshot(driver, dataSource string) (*outputEnvelope, error) {
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	fighters, err := loadFightersSQL(db)
+	if err != nil {
+		return nil, err
+	}
+	return &outputEnvelope{Fighters: fighters}, nil
+}
+
+func loadNDJSONSnapshot(path string) (*outputEnvelope, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Later lines win, so an uncompacted stream reads the same as a compacted one
+	var fighters []FighterStats
+	index := make(map[string]int)
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var fighter FighterStats
+		if err := decoder.Decode(&fighter); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		id := fighterID(&fighter)
+		if i, ok := index[id]; ok {
+			fighters[i] = fighter
+			continue
+		}
+		index[id] = len(fighters)
+		fighters = append(fighters, fighter)
+	}
+	return &outputEnvelope{Fighters: fighters}, nil
+}
+
+// diffDatasets compares two snapshots. Fighters are matched by their key, and per-fight rows
+// by date and opponent, since a row's position shifts whenever a new fight is added.
+func diffDatasets(oldFighters, newFighters []FighterStats) datasetDiff {
+	diff := datasetDiff{
+		NewFighters:     []diffFighter{},
+		RemovedFighters: []diffFighter{},
+		NewFights:       []diffFight{},
+		ChangedRecords:  []diffChange{},
+		ChangedBio:      []diffChange{},
+		CorrectedStats:  []diffChange{},
+	}
+
+	oldByID := make(map[string]*FighterStats)
+	for i := range oldFighters {
+		oldByID[fighterID(&oldFighters[i])] = &oldFighters[i]
+	}
+	newIDs := make(map[string]bool)
+
+	for i := range newFighters {
+		fighter := &newFighters[i]
+		id := fighterID(fighter)
+		name := fighter.FirstName + " " + fighter.LastName
+		newIDs[id] = true
+
+		old, ok := oldByID[id]
+		if !ok {
+			diff.NewFighters = append(diff.NewFighters, diffFighter{ID: id, Name: name})
+			continue
+		}
+
+		// Bio and record fields
+		columns, oldValues := stringColumns(*old, "id")
+		_, newValues := stringColumns(*fighter, "id")
+		for j, column := range columns {
+			if oldValues[j] == newValues[j] {
+				continue
+			}
+			change := diffChange{FighterID: id, Name: name, Field: column, Old: oldValues[j].(string), New: newValues[j].(string)}
+			if containsString(recordFields, column) {
+				diff.ChangedRecords = append(diff.ChangedRecords, change)
+			} else {
+				diff.ChangedBio = append(diff.ChangedBio, change)
+			}
+		}
+
+		// Fights that weren't there before, and corrections to those that were
+		oldFights := make(map[string]Fight)
+		for _, fight := range old.Fights {
+			oldFights[fightKey(fight.Date, fight.Opponent)] = fight
+		}
+		for _, fight := range fighter.Fights {
+			oldFight, ok := oldFights[fightKey(fight.Date, fight.Opponent)]
+			if !ok {
+				diff.NewFights = append(diff.NewFights, diffFight{
+					FighterID: id,
+					Name:      name,
+					Date:      fight.Date,
+					Opponent:  fight.Opponent,
+					Event:     fight.Event,
+					Result:    fight.Result,
+				})
+				continue
+			}
+			diff.CorrectedStats = append(diff.CorrectedStats, diffRows(id, name, "fights", fight.Date, fight.Opponent, oldFight, fight)...)
+		}
+
+		oldStriking := make(map[string]StrikingStats)
+		for _, stats := range old.StrikingStats {
+			oldStriking[fightKey(stats.Date, stats.Opponent)] = stats
+		}
+		for _, stats := range fighter.StrikingStats {
+			if oldStats, ok := oldStriking[fightKey(stats.Date, stats.Opponent)]; ok {
+				diff.CorrectedStats = append(diff.CorrectedStats, diffRows(id, name, "striking", stats.Date, stats.Opponent, oldStats, stats)...)
+			}
+		}
+
+		oldClinch := make(map[string]ClinchStats)
+		for _, stats := range old.ClinchStats {
+			oldClinch[fightKey(stats.Date, stats.Opponent)] = stats
+		}
+		for _, stats := range fighter.ClinchStats {
+			if oldStats, ok := oldClinch[fightKey(stats.Date, stats.Opponent)]; ok {
+				diff.CorrectedStats = append(diff.CorrectedStats, diffRows(id, name, "clinch", stats.Date, stats.Opponent, oldStats, stats)...)
+			}
+		}
+
+		oldGround := make(map[string]GroundStats)
+		for _, stats := range old.GroundStats {
+			oldGround[fightKey(stats.Date, stats.Opponent)] = stats
+		}
+		for _, stats := range fighter.GroundStats {
+			if oldStats, ok := oldGround[fightKey(stats.Date, stats.Opponent)]; ok {
+				diff.CorrectedStats = append(diff.CorrectedStats, diffRows(id, name, "ground", stats.Date, stats.Opponent, oldStats, stats)...)
+			}
+		}
+	}
+
+	for i := range oldFighters {
+		id := fighterID(&oldFighters[i])
+		if !newIDs[id] {
+			diff.RemovedFighters = append(diff.RemovedFighters, diffFighter{ID: id, Name: oldFighters[i].FirstName + " " + oldFighters[i].LastName})
+		}
+	}
+
+	sort.Slice(diff.NewFighters, func(i, j int) bool { return diff.NewFighters[i].Name < diff.NewFighters[j].Name })
+	sort.Slice(diff.RemovedFighters, func(i, j int) bool { return diff.RemovedFighters[i].Name < diff.RemovedFighters[j].Name })
+	sort.SliceStable(diff.NewFights, func(i, j int) bool { return diff.NewFights[i].Name < diff.NewFights[j].Name })
+	for _, changes := range [][]diffChange{diff.ChangedRecords, diff.ChangedBio, diff.CorrectedStats} {
+		sort.SliceStable(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	}
+	return diff
+}
+
+// diffRows compares the string fields of two rows of the same per-fight table
+func diffRows(fighterID, name, table, date, opponent string, oldRow, newRow interface{}) []diffChange {
+	var changes []diffChange
+	columns, oldValues := stringColumns(oldRow, "date", "opponent")
+	_, newValues := stringColumns(newRow, "date", "opponent")
+	for i, column := range columns {
+		if oldValues[i] != newValues[i] {
+			changes = append(changes, diffChange{
+				FighterID: fighterID,
+				Name:      name,
+				Table:     table,
+				Date:      date,
+				Opponent:  opponent,
+				Field:     column,
+				Old:       oldValues[i].(string),
+				New:       newValues[i].(string),
+			})
+		}
+	}
+	return changes
+}
+
+func fightKey(date, opponent string) string {
+	return date + "|" + strings.ToLower(opponent)
+}
+
+// writeDiffSummary prints the diff for a person to read
+func writeDiffSummary(w io.Writer, diff *datasetDiff) {
+	fmt.Fprintf(w, "Comparing %s with %s\n", describeSnapshot(diff.Old), describeSnapshot(diff.New))
+
+	total := len(diff.NewFighters) + len(diff.RemovedFighters) + len(diff.NewFights) +
+		len(diff.ChangedRecords) + len(diff.ChangedBio) + len(diff.CorrectedStats)
+	if total == 0 {
+		fmt.Fprintln(w, "\nNo changes")
+		return
+	}
+
+	if len(diff.NewFighters) > 0 {
+		fmt.Fprintf(w, "\nNew fighters (%d):\n", len(diff.NewFighters))
+		for _, fighter := range diff.NewFighters {
+			fmt.Fprintf(w, "  + %s (%s)\n", fighter.Name, fighter.ID)
+		}
+	}
+	if len(diff.RemovedFighters) > 0 {
+		fmt.Fprintf(w, "\nRemoved fighters (%d):\n", len(diff.RemovedFighters))
+		for _, fighter := range diff.RemovedFighters {
+			fmt.Fprintf(w, "  - %s (%s)\n", fighter.Name, fighter.ID)
+		}
+	}
+	if len(diff.NewFights) > 0 {
+		fmt.Fprintf(w, "\nNew fights (%d):\n", len(diff.NewFights))
+		for _, fight := range diff.NewFights {
+			fmt.Fprintf(w, "  + %s vs %s, %s, %s (%s)\n", fight.Name, fight.Opponent, fight.Date, fight.Event, fight.Result)
+		}
+	}
+	writeDiffChanges(w, "Changed records", diff.ChangedRecords)
+	writeDiffChanges(w, "Changed bio fields", diff.ChangedBio)
+	writeDiffChanges(w, "Corrected stats", diff.CorrectedStats)
+}
+
+func writeDiffChanges(w io.Writer, title string, changes []diffChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s (%d):\n", title, len(changes))
+	for _, change := range changes {
+		where := change.Name
+		if change.Table != "" {
+			where = fmt.Sprintf("%s, %s vs %s on %s", change.Name, change.Table, change.Opponent, change.Date)
+		}
+		fmt.Fprintf(w, "  ~ %s: %s %q -> %q\n", where, change.Field, change.Old, change.New)
+	}
+}
+
+func describeSnapshot(summary snapshotSummary) string {
+	if summary.RunID != "" {
+		return fmt.Sprintf("%s (run %s, %d fighters)", summary.Source, summary.RunID, summary.Fighters)
+	}
+	return fmt.Sprintf("%s (%d fighters)", summary.Source, summary.Fighters)
+}
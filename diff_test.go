@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadOnlySQLite(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"fighters.db", "file:fighters.db?mode=ro"},
+		{"/data/fighters.db", "file:/data/fighters.db?mode=ro"},
+		{"/data/run 1?#%.db", "file:/data/run%201%3F%23%25.db?mode=ro"},
+	}
+	for _, test := range tests {
+		if got := readOnlySQLite(test.path); got != test.want {
+			t.Errorf("readOnlySQLite(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+// A database whose path has characters that mean something in a URI is still found
+func TestLoadSQLiteSnapshotEscapesPath(t *testing.T) {
+	written := filepath.Join(t.TempDir(), "run")
+	if err := os.Mkdir(written, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&sqliteSink{Path: filepath.Join(written, "fighters.db")}).Write(sqlTestFighters()); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(filepath.Dir(written), "run 1?#%")
+	if err := os.Rename(written, dir); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := loadSnapshot(filepath.Join(dir, "fighters.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Fighters) != 2 {
+		t.Errorf("%d fighters, want 2", len(snapshot.Fighters))
+	}
+	// go-sqlite3 would create a new file at a misread path instead of failing
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "fighters.db" {
+			t.Errorf("loading created %s", entry.Name())
+		}
+	}
+}
+
+func TestDiffDatasets(t *testing.T) {
+	oldFighters := testSnapshot().Fighters
+	oldFighters[0].StrikingStats = []StrikingStats{{Date: "Jul 10, 2021", Opponent: "Dustin Poirier", TSL: "16", TSA: "41"}}
+	oldFighters = append(oldFighters, FighterStats{ID: "2335479", FirstName: "Jose", LastName: "Aldo"})
+
+	newFighters := testSnapshot().Fighters
+	// A new fight, before the old one, with the old one's stats corrected
+	newFighters[1].Fights = append([]Fight{{Date: "Jul 29, 2023", Opponent: "Justin Gaethje", Event: "UFC 291", Result: "L"}}, newFighters[1].Fights...)
+	newFighters[1].WinLossRecord = "30-9-0"
+	newFighters[0].StrikingStats = []StrikingStats{{Date: "Jul 10, 2021", Opponent: "dustin poirier", TSL: "17", TSA: "41"}}
+	newFighters[0].Fights[0].Time = "4:59"
+	newFighters[0].Team = "SBG Ireland"
+	newFighters = append(newFighters, FighterStats{ID: "4350812", FirstName: "Ilia", LastName: "Topuria"})
+
+	diff := diffDatasets(oldFighters, newFighters)
+	want := datasetDiff{
+		NewFighters:     []diffFighter{{ID: "4350812", Name: "Ilia Topuria"}},
+		RemovedFighters: []diffFighter{{ID: "2335479", Name: "Jose Aldo"}},
+		NewFights:       []diffFight{{FighterID: "2335639", Name: "Dustin Poirier", Date: "Jul 29, 2023", Opponent: "Justin Gaethje", Event: "UFC 291", Result: "L"}},
+		ChangedRecords:  []diffChange{{FighterID: "2335639", Name: "Dustin Poirier", Field: "win_loss_record", Old: "30-8-0", New: "30-9-0"}},
+		ChangedBio:      []diffChange{{FighterID: "3022677", Name: "Conor McGregor", Field: "team", Old: "", New: "SBG Ireland"}},
+		CorrectedStats: []diffChange{
+			{FighterID: "3022677", Name: "Conor McGregor", Table: "fights", Date: "Jul 10, 2021", Opponent: "Dustin Poirier", Field: "time", Old: "5:00", New: "4:59"},
+			{FighterID: "3022677", Name: "Conor McGregor", Table: "striking", Date: "Jul 10, 2021", Opponent: "dustin poirier", Field: "tsl", Old: "16", New: "17"},
+		},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff\n%+v\nwant\n%+v", diff, want)
+	}
+
+	// The same snapshot has no changes, and empty lists rather than nulls in JSON
+	diff = diffDatasets(oldFighters, oldFighters)
+	if diff.NewFighters == nil || len(diff.NewFighters)+len(diff.RemovedFighters)+len(diff.NewFights)+len(diff.ChangedRecords)+len(diff.ChangedBio)+len(diff.CorrectedStats) != 0 {
+		t.Errorf("diff of a snapshot with itself %+v", diff)
+	}
+}
+
+// An NDJSON stream that wasn't compacted reads as its last line for each fighter
+func TestLoadNDJSONSnapshotKeepsLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fighters.ndjson")
+	data := `{"id":"1","first_name":"Test","last_name":"One","team":"Old"}
+{"id":"2","first_name":"Test","last_name":"Two"}
+{"id":"1","first_name":"Test","last_name":"One","team":"New"}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := loadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Fighters) != 2 || snapshot.Fighters[0].Team != "New" || snapshot.Fighters[1].LastName != "Two" {
+		t.Errorf("fighters %+v", snapshot.Fighters)
+	}
+}
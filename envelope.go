@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"runtime/debug"
+	"time"
+)
+
+// outputSchemaVersion is bumped whenever a field is renamed, removed or changes meaning.
+// Version 1 was the bare array of fighters written before the envelope existed.
+const outputSchemaVersion = 2
+
+// runInfo identifies a crawl run in everything it writes
+type runInfo struct {
+	ID         string
+	StartedAt  time.Time
+	Source     outputSource
+	Politeness *politenessMetadata // How the run was crawled; nil when it didn't crawl
+}
+
+// outputEnvelope wraps the fighters in fighters.json with what a consumer needs to know
+// about them
+type outputEnvelope struct {
+	SchemaVersion  int                 `json:"schema_version"`
+	GeneratedAt    time.Time           `json:"generated_at"`
+	RunID          string              `json:"run_id"`
+	ScraperVersion string              `json:"scraper_version"`
+	Source         outputSource        `json:"source"`
+	Politeness     *politenessMetadata `json:"politeness,omitempty"`
+	Counts         outputCounts        `json:"counts"`
+	Fighters       []FighterStats      `json:"fighters"`
+}
+
+// outputSource is where a run started crawling
+type outputSource struct {
+	Name string `json:"name"` // html, api or snapshot
+	URL  string `json:"url"`
+}
+
+type outputCounts struct {
+	Fighters      int `json:"fighters" description:"Number of fighters"`
+	Fights        int `json:"fights" description:"Number of fights across all fighters"`
+	StrikingStats int `json:"striking_stats" description:"Number of striking stat rows across all fighters"`
+	ClinchStats   int `json:"clinch_stats" description:"Number of clinch stat rows across all fighters"`
+	GroundStats   int `json:"ground_stats" description:"Number of ground stat rows across all fighters"`
+}
+
+// newRunInfo starts a run with an ID that sorts by start time, e.g. 20240711T031500Z-9f86d081
+func newRunInfo(start time.Time, source outputSource) *runInfo {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return &runInfo{
+		ID:        start.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		StartedAt: start,
+		Source:    source,
+	}
+}
+
+func newOutputEnvelope(run *runInfo, fighters []FighterStats) outputEnvelope {
+	envelope := outputEnvelope{
+		SchemaVersion:  outputSchemaVersion,
+		GeneratedAt:    time.Now().UTC(),
+		RunID:          run.ID,
+		ScraperVersion: scraperVersion(),
+		Source:         run.Source,
+		Politeness:     run.Politeness,
+		Fighters:       fighters,
+	}
+	if envelope.Fighters == nil {
+		envelope.Fighters = []FighterStats{}
+	}
+	envelope.Counts.Fighters = len(fighters)
+	for i := range fighters {
+		envelope.Counts.Fights += len(fighters[i].Fights)
+		envelope.Counts.StrikingStats += len(fighters[i].StrikingStats)
+		envelope.Counts.ClinchStats += len(fighters[i].ClinchStats)
+		envelope.Counts.GroundStats += len(fighters[i].GroundStats)
+	}
+	return envelope
+}
+
+// readOutputFile loads a fighters.json file. Files written before the envelope existed hold a
+// bare array; they are returned in an envelope with schema version 1 and no metadata.
+func readOutputFile(path string) (*outputEnvelope, error) {
+	jsonData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fighters []FighterStats
+	if err := json.Unmarshal(jsonData, &fighters); err == nil {
+		return &outputEnvelope{SchemaVersion: 1, Fighters: fighters}, nil
+	}
+
+	var envelope outputEnvelope
+	if err := json.Unmarshal(jsonData, &envelope); err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+// scraperVersion is the VCS revision the binary was built from, or the module version when
+// that isn't known
+func scraperVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return info.Main.Version
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeRecordsPoliteness(t *testing.T) {
+	policy := politenessPolicy{RespectRobotsTxt: true, MinDelay: 10 * time.Second, RandomDelay: 4 * time.Second, Parallelism: 1, MaxRequestsPerHour: 300}.metadata()
+	run := newRunInfo(time.Now(), outputSource{Name: "html", URL: "https://www.espn.com/mma/"})
+	run.Politeness = &policy
+
+	jsonData, err := json.Marshal(newOutputEnvelope(run, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope struct {
+		Politeness map[string]interface{} `json:"politeness"`
+	}
+	if err := json.Unmarshal(jsonData, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"respect_robots_txt": true, "min_delay": "10s", "random_delay": "4s", "parallelism": 1.0, "max_requests_per_hour": 300.0,
+	}
+	for key, value := range want {
+		if envelope.Politeness[key] != value {
+			t.Errorf("politeness.%s = %v, want %v", key, envelope.Politeness[key], value)
+		}
+	}
+
+	// A run that didn't crawl leaves it out
+	run.Politeness = nil
+	jsonData, err = json.Marshal(newOutputEnvelope(run, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(jsonData, []byte(`"politeness"`)) {
+		t.Errorf("politeness written without a policy: %s", jsonData)
+	}
+}
+
+// fighters.schema.json is generated from the structs; regenerate it with go run . schema
+func TestSchemaFileIsCurrent(t *testing.T) {
+	published, err := os.ReadFile("fighters.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated bytes.Buffer
+	if err := writeOutputJSONSchema(&generated); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(published, generated.Bytes()) {
+		t.Error("fighters.schema.json is out of date; run go run . schema > fighters.schema.json")
+	}
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+const (
+	defaultESPNAPIBaseURL    = "https://site.web.api.espn.com/apis/common/v3/sports/mma"
+	defaultESPNScoreboardURL = "https://site.api.espn.com/apis/site/v2/sports/mma/ufc/scoreboard"
+)
+
+// espnAPISource scrapes fighters from the JSON endpoints behind ESPN's own frontend instead
+// of the HTML pages. It starts from the event cards on the scoreboard, fetches the profile,
+// stats and fight history of every fighter on them, and follows their opponents from there.
+type espnAPISource struct {
+	BaseURL       string   // Base of the athlete endpoints
+	ScoreboardURL string   // Scoreboard listing the event cards
+	Dates         string   // Scoreboard dates to start from, e.g. "2024" or "20240101-20240630"
+	AthleteIDs    []string // When set, only these fighters are fetched, without their opponents
+
+	c         *colly.Collector
+	wg        *sync.WaitGroup
+	onFighter func(fighterKey string, stats *FighterStats)
+
+	mu       sync.Mutex
+	fighters map[string]*apiFighter // Fighters being assembled, keyed by ESPN athlete ID
+}
+
+// apiFighter is a fighter whose three endpoints are still being fetched
+type apiFighter struct {
+	stats FighterStats
+	parts int
+	done  bool
+}
+
+// A fighter is assembled from the profile, stats and fight history endpoints
+const apiPartCount = 3
+
+type apiAthleteResponse struct {
+	Athlete struct {
+		ID            string `json:"id"`
+		FirstName     string `json:"firstName"`
+		LastName      string `json:"lastName"`
+		Nickname      string `json:"nickname"`
+		DisplayHeight string `json:"displayHeight"`
+		DisplayWeight string `json:"displayWeight"`
+		DisplayDOB    string `json:"displayDOB"`
+		Association   struct {
+			Name string `json:"name"`
+		} `json:"association"`
+		Stance struct {
+			Text string `json:"text"`
+		} `json:"stance"`
+		StatsSummary struct {
+			Statistics []struct {
+				Name         string `json:"name"`
+				DisplayValue string `json:"displayValue"`
+			} `json:"statistics"`
+		} `json:"statsSummary"`
+	} `json:"athlete"`
+}
+
+// apiEvent is a single bout as it appears in the stats and fight history responses
+type apiEvent struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	GameDate   string `json:"gameDate"`
+	GameResult string `json:"gameResult"`
+	Opponent   struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"displayName"`
+	} `json:"opponent"`
+	Status struct {
+		Period       int    `json:"period"`
+		DisplayClock string `json:"displayClock"`
+		Result       struct {
+			DisplayName string `json:"displayName"`
+		} `json:"result"`
+	} `json:"status"`
+}
+
+type apiStatsResponse struct {
+	Categories []struct {
+		Name       string `json:"name"`
+		Statistics []struct {
+			EventID string   `json:"eventId"`
+			Stats   []string `json:"stats"`
+		} `json:"statistics"`
+	} `json:"categories"`
+	Events map[string]apiEvent `json:"events"`
+}
+
+type apiFightHistoryResponse struct {
+	Events map[string]apiEvent `json:"events"`
+}
+
+type apiScoreboardResponse struct {
+	Events []struct {
+		ID           string `json:"id"`
+		Name         string `json:"name"`
+		Competitions []struct {
+			Competitors []struct {
+				ID string `json:"id"`
+			} `json:"competitors"`
+		} `json:"competitions"`
+	} `json:"events"`
+}
+
+// loadESPNAPISource reads the endpoint settings from the environment. MMA_API_BASE_URL and
+// MMA_API_SCOREBOARD_URL point the source at a different server, and MMA_API_DATES picks the
+// scoreboard dates to start from (the current year by default).
+func loadESPNAPISource() *espnAPISource {
+	s := &espnAPISource{
+		BaseURL:       defaultESPNAPIBaseURL,
+		ScoreboardURL: defaultESPNScoreboardURL,
+		Dates:         time.Now().Format("2006"),
+		fighters:      make(map[string]*apiFighter),
+	}
+	if env := os.Getenv("MMA_API_BASE_URL"); env != "" {
+		s.BaseURL = strings.TrimSuffix(env, "/")
+	}
+	if env := os.Getenv("MMA_API_SCOREBOARD_URL"); env != "" {
+		s.ScoreboardURL = env
+	}
+	if env := os.Getenv("MMA_API_DATES"); env != "" {
+		s.Dates = env
+	}
+	return s
+}
+
+// allowedDomains returns the hosts the source needs to reach
+func (s *espnAPISource) allowedDomains() ([]string, error) {
+	var domains []string
+	for _, raw := range []string{s.BaseURL, s.ScoreboardURL} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API URL %q: %v", raw, err)
+		}
+		domains = append(domains, u.Host)
+	}
+	return domains, nil
+}
+
+// register hooks the source into the collector. onFighter is called once for every fighter
+// as soon as all of their endpoints have been fetched.
+func (s *espnAPISource) register(c *colly.Collector, wg *sync.WaitGroup, onFighter func(fighterKey string, stats *FighterStats)) {
+	s.c = c
+	s.wg = wg
+	s.onFighter = onFighter
+
+	c.OnResponse(func(r *colly.Response) {
+		if isBannedOrRateLimited(r) {
+			return
+		}
+		requestURL := r.Request.URL.String()
+		if strings.HasPrefix(requestURL, s.ScoreboardURL) {
+			s.parseScoreboard(r)
+			return
+		}
+		if !strings.HasPrefix(requestURL, s.BaseURL+"/athletes/") {
+			return
+		}
+
+		// The path after the base is athletes/{id} or athletes/{id}/{endpoint}
+		parts := strings.Split(strings.TrimPrefix(requestURL, s.BaseURL+"/"), "/")
+		athleteID := parts[1]
+		s.update(athleteID, false, func(stats *FighterStats) {
+			stats.ScrapedAt = time.Now().UTC()
+			stats.SourceURLs = append(stats.SourceURLs, requestURL)
+		})
+		var err error
+		switch {
+		case len(parts) == 2:
+			err = s.parseProfile(athleteID, r.Body)
+		case parts[2] == "stats":
+			err = s.parseStats(athleteID, r.Body)
+		case parts[2] == "fighthistory":
+			err = s.parseFightHistory(athleteID, r.Body)
+		}
+		if err != nil {
+			log.Printf("Error parsing API response from %s: %v\n", requestURL, err)
+		}
+	})
+}
+
+// start visits the scoreboard to discover the event cards, or the requested fighters
+func (s *espnAPISource) start() error {
+	if len(s.AthleteIDs) > 0 {
+		for _, athleteID := range s.AthleteIDs {
+			s.visitAthlete(athleteID)
+		}
+		return nil
+	}
+
+	scoreboardURL, err := url.Parse(s.ScoreboardURL)
+	if err != nil {
+		return err
+	}
+	query := scoreboardURL.Query()
+	query.Set("dates", s.Dates)
+	scoreboardURL.RawQuery = query.Encode()
+	return s.c.Visit(scoreboardURL.String())
+}
+
+// flush hands over fighters that never got all of their endpoints, e.g. because one of the
+// requests failed for good. Call it once the crawl is done.
+func (s *espnAPISource) flush() {
+	s.mu.Lock()
+	var incomplete []FighterStats
+	for _, fighter := range s.fighters {
+		if !fighter.done && fighter.stats.FirstName != "" {
+			fighter.done = true
+			incomplete = append(incomplete, fighter.stats)
+		}
+	}
+	s.mu.Unlock()
+
+	for i := range incomplete {
+		s.onFighter(apiFighterKey(&incomplete[i]), &incomplete[i])
+	}
+}
+
+func (s *espnAPISource) parseScoreboard(r *colly.Response) {
+	var scoreboard apiScoreboardResponse
+	if err := json.Unmarshal(r.Body, &scoreboard); err != nil {
+		log.Printf("Error parsing scoreboard from %s: %v\n", r.Request.URL, err)
+		return
+	}
+	for _, event := range scoreboard.Events {
+		for _, competition := range event.Competitions {
+			for _, competitor := range competition.Competitors {
+				s.visitAthlete(competitor.ID)
+			}
+		}
+	}
+}
+
+// visitAthlete fetches the profile, stats and fight history of a fighter the first time it is seen
+func (s *espnAPISource) visitAthlete(athleteID string) {
+	if athleteID == "" {
+		return
+	}
+	s.mu.Lock()
+	_, seen := s.fighters[athleteID]
+	if !seen {
+		s.fighters[athleteID] = &apiFighter{}
+	}
+	s.mu.Unlock()
+	if seen {
+		return
+	}
+
+	athleteURL := s.BaseURL + "/athletes/" + athleteID
+	for _, link := range []string{athleteURL, athleteURL + "/stats", athleteURL + "/fighthistory"} {
+		s.wg.Add(1)
+		go func(link string) {
+			defer s.wg.Done()
+			s.c.Visit(link)
+		}(link)
+	}
+}
+
+// update applies a change to a fighter. Once every endpoint has counted as a part, the fighter
+// is complete and a copy is handed over; the receiver owns the copy, so later responses for a
+// fighter that was already handed over are ignored.
+func (s *espnAPISource) update(athleteID string, part bool, apply func(stats *FighterStats)) {
+	s.mu.Lock()
+	fighter, ok := s.fighters[athleteID]
+	if !ok {
+		fighter = &apiFighter{}
+		s.fighters[athleteID] = fighter
+	}
+	if fighter.done {
+		s.mu.Unlock()
+		log.Printf("Ignoring a late API response for athlete %s, who was already handed over\n", athleteID)
+		return
+	}
+	apply(&fighter.stats)
+	if part {
+		fighter.parts++
+	}
+	complete := fighter.parts == apiPartCount
+	var stats FighterStats
+	if complete {
+		fighter.done = true
+		stats = fighter.stats
+	}
+	s.mu.Unlock()
+
+	if complete {
+		s.onFighter(apiFighterKey(&stats), &stats)
+	}
+}
+
+func (s *espnAPISource) parseProfile(athleteID string, body []byte) error {
+	var profile apiAthleteResponse
+	if err := json.Unmarshal(body, &profile); err != nil {
+		return err
+	}
+	athlete := profile.Athlete
+
+	s.update(athleteID, true, func(stats *FighterStats) {
+		stats.ID = athleteID
+		stats.FirstName = displayName(athlete.FirstName)
+		stats.LastName = displayName(athlete.LastName)
+		stats.Nickname = athlete.Nickname
+		stats.Birthdate = athlete.DisplayDOB
+		stats.Team = athlete.Association.Name
+		stats.Stance = athlete.Stance.Text
+
+		// Match the "5' 9\", 155 lbs" format of the HTML bio
+		var heightAndWeight []string
+		for _, value := range []string{athlete.DisplayHeight, athlete.DisplayWeight} {
+			if value != "" {
+				heightAndWeight = append(heightAndWeight, value)
+			}
+		}
+		stats.HeightAndWeight = strings.Join(heightAndWeight, ", ")
+
+		for _, stat := range athlete.StatsSummary.Statistics {
+			name := strings.ToLower(stat.Name)
+			switch {
+			case name == "wins-losses-draws":
+				stats.WinLossRecord = stat.DisplayValue
+			case strings.Contains(name, "knockout"):
+				stats.TKORecord = stat.DisplayValue
+			case strings.Contains(name, "submission"):
+				stats.SubRecord = stat.DisplayValue
+			}
+		}
+	})
+	return nil
+}
+
+func (s *espnAPISource) parseStats(athleteID string, body []byte) error {
+	var response apiStatsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+
+	s.update(athleteID, true, func(stats *FighterStats) {
+		// The stat values are listed in the same column order as the tables on the stats page,
+		// minus the date, opponent, event and result columns
+		for _, category := range response.Categories {
+			for _, row := range category.Statistics {
+				event := response.Events[row.EventID]
+				date := formatAPIDate(event.GameDate)
+				switch strings.ToLower(category.Name) {
+				case "striking":
+					striking := strikingStatsFromValues(row.Stats)
+					striking.Date, striking.Opponent, striking.Event, striking.Result = date, event.Opponent.DisplayName, event.Name, event.GameResult
+					stats.StrikingStats = append(stats.StrikingStats, striking)
+				case "clinch":
+					clinch := clinchStatsFromValues(row.Stats)
+					clinch.Date, clinch.Opponent, clinch.Event, clinch.Result = date, event.Opponent.DisplayName, event.Name, event.GameResult
+					stats.ClinchStats = append(stats.ClinchStats, clinch)
+				case "ground":
+					ground := groundStatsFromValues(row.Stats)
+					ground.Date, ground.Opponent, ground.Event, ground.Result = date, event.Opponent.DisplayName, event.Name, event.GameResult
+					stats.GroundStats = append(stats.GroundStats, ground)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+func (s *espnAPISource) parseFightHistory(athleteID string, body []byte) error {
+	var response apiFightHistoryResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+
+	// List the most recent fight first, like the fight history page
+	events := make([]apiEvent, 0, len(response.Events))
+	for _, event := range response.Events {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].GameDate > events[j].GameDate
+	})
+
+	s.update(athleteID, true, func(stats *FighterStats) {
+		for _, event := range events {
+			fight := Fight{
+				Date:     formatAPIDate(event.GameDate),
+				Opponent: event.Opponent.DisplayName,
+				Event:    event.Name,
+				Result:   event.GameResult,
+				Decision: event.Status.Result.DisplayName,
+				Time:     event.Status.DisplayClock,
+			}
+			if event.Status.Period > 0 {
+				fight.Rnd = fmt.Sprint(event.Status.Period)
+			}
+			stats.Fights = append(stats.Fights, fight)
+		}
+	})
+
+	// Keep crawling through the opponents
+	if len(s.AthleteIDs) == 0 {
+		for _, event := range events {
+			s.visitAthlete(event.Opponent.ID)
+		}
+	}
+	return nil
+}
+
+func apiFighterKey(stats *FighterStats) string {
+	return nameKey(stats.FirstName + " " + stats.LastName)
+}
+
+// formatAPIDate converts an API timestamp to the "Jan 2, 2006" format of the HTML tables
+func formatAPIDate(value string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("Jan 2, 2006")
+		}
+	}
+	return value
+}
+
+func strikingStatsFromValues(values []string) StrikingStats {
+	var stats StrikingStats
+	fields := []*string{
+		&stats.SDblA, &stats.SDhlA, &stats.SDllA, &stats.TSL, &stats.TSA, &stats.SSL,
+		&stats.SSA, &stats.TSL_TSA, &stats.KD, &stats.PercentBody, &stats.PercentHead, &stats.PercentLeg,
+	}
+	for i := 0; i < len(fields) && i < len(values); i++ {
+		*fields[i] = values[i]
+	}
+	return stats
+}
+
+func clinchStatsFromValues(values []string) ClinchStats {
+	var stats ClinchStats
+	fields := []*string{
+		&stats.SCBL, &stats.SCBA, &stats.SCHL, &stats.SCHA, &stats.SCLL, &stats.SCLA,
+		&stats.RV, &stats.SR, &stats.TDL, &stats.TDA, &stats.TDS, &stats.TK_ACC,
+	}
+	for i := 0; i < len(fields) && i < len(values); i++ {
+		*fields[i] = values[i]
+	}
+	return stats
+}
+
+func groundStatsFromValues(values []string) GroundStats {
+	var stats GroundStats
+	fields := []*string{
+		&stats.SGBL, &stats.SGBA, &stats.SGHL, &stats.SGHA, &stats.SGLL, &stats.SGLA,
+		&stats.AD, &stats.ADTB, &stats.ADHG, &stats.ADTM, &stats.ADTS, &stats.SM,
+	}
+	for i := 0; i < len(fields) && i < len(values); i++ {
+		*fields[i] = values[i]
+	}
+	return stats
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gocolly/colly"
+)
+
+// newTestESPNAPI serves the fixtures in testdata/espn_api, where a request for /mma/athletes/1
+// or /sb is answered with athletes/1.json or sb.json. It records every URL it was asked for.
+func newTestESPNAPI(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.String())
+		mu.Unlock()
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/mma/")
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeFile(w, r, filepath.Join("testdata", "espn_api", filepath.FromSlash(name)+".json"))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+// crawlTestESPNAPI runs the source against the server like crawl does and returns the fighters
+// it handed over, keyed by fighter key
+func crawlTestESPNAPI(t *testing.T, server *httptest.Server, athleteIDs ...string) map[string]FighterStats {
+	t.Helper()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &espnAPISource{
+		BaseURL:       server.URL + "/mma",
+		ScoreboardURL: server.URL + "/sb",
+		Dates:         "20210710",
+		AthleteIDs:    athleteIDs,
+		fighters:      make(map[string]*apiFighter),
+	}
+	c := colly.NewCollector(colly.AllowedDomains(serverURL.Host))
+
+	var mu sync.Mutex
+	fighters := make(map[string]FighterStats)
+	var wg sync.WaitGroup
+	source.register(c, &wg, func(fighterKey string, stats *FighterStats) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := fighters[fighterKey]; ok {
+			t.Errorf("%s handed over twice", fighterKey)
+		}
+		fighters[fighterKey] = *stats
+	})
+	if err := source.start(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	source.flush()
+	return fighters
+}
+
+func TestESPNAPISourceWalksScoreboard(t *testing.T) {
+	server, requests := newTestESPNAPI(t)
+	fighters := crawlTestESPNAPI(t, server)
+
+	// McGregor is on the scoreboard, and Poirier is found through his fight history
+	if len(fighters) != 2 {
+		t.Fatalf("%d fighters, want 2: %v", len(fighters), fighters)
+	}
+	if got := requests(); len(got) == 0 || got[0] != "/sb?dates=20210710" {
+		t.Errorf("first request %v, want the scoreboard for 20210710", got)
+	}
+
+	mcgregor, ok := fighters["conor mcgregor"]
+	if !ok {
+		t.Fatalf("no conor mcgregor in %v", fighters)
+	}
+	want := FighterStats{
+		ID:              "3022677",
+		FirstName:       "Conor",
+		LastName:        "McGregor",
+		Nickname:        "The Notorious",
+		Birthdate:       "7/14/1988",
+		Team:            "SBG Ireland",
+		Stance:          "Southpaw",
+		HeightAndWeight: "5' 9\", 155 lbs",
+		WinLossRecord:   "22-6-0",
+		TKORecord:       "19-2",
+		SubRecord:       "1-4",
+	}
+	for _, field := range []struct{ name, got, want string }{
+		{"ID", mcgregor.ID, want.ID},
+		{"FirstName", mcgregor.FirstName, want.FirstName},
+		{"LastName", mcgregor.LastName, want.LastName},
+		{"Nickname", mcgregor.Nickname, want.Nickname},
+		{"Birthdate", mcgregor.Birthdate, want.Birthdate},
+		{"Team", mcgregor.Team, want.Team},
+		{"Stance", mcgregor.Stance, want.Stance},
+		{"HeightAndWeight", mcgregor.HeightAndWeight, want.HeightAndWeight},
+		{"WinLossRecord", mcgregor.WinLossRecord, want.WinLossRecord},
+		{"TKORecord", mcgregor.TKORecord, want.TKORecord},
+		{"SubRecord", mcgregor.SubRecord, want.SubRecord},
+	} {
+		if field.got != field.want {
+			t.Errorf("%s = %q, want %q", field.name, field.got, field.want)
+		}
+	}
+
+	// The most recent fight comes first
+	wantFights := []Fight{
+		{Date: "Jul 11, 2021", Opponent: "Dustin Poirier", Event: "UFC 264: Poirier vs. McGregor 3", Result: "L", Decision: "KO/TKO", Rnd: "1", Time: "5:00"},
+		{Date: "Jan 24, 2021", Opponent: "Dustin Poirier", Event: "UFC 257: Poirier vs. McGregor 2", Result: "L", Decision: "KO/TKO", Rnd: "2", Time: "2:32"},
+	}
+	if len(mcgregor.Fights) != len(wantFights) {
+		t.Fatalf("fights %+v, want %+v", mcgregor.Fights, wantFights)
+	}
+	for i := range wantFights {
+		if mcgregor.Fights[i] != wantFights[i] {
+			t.Errorf("fight %d = %+v, want %+v", i, mcgregor.Fights[i], wantFights[i])
+		}
+	}
+
+	if len(mcgregor.StrikingStats) != 1 || len(mcgregor.ClinchStats) != 1 || len(mcgregor.GroundStats) != 1 {
+		t.Fatalf("%d striking, %d clinch and %d ground rows, want 1 each",
+			len(mcgregor.StrikingStats), len(mcgregor.ClinchStats), len(mcgregor.GroundStats))
+	}
+	striking := mcgregor.StrikingStats[0]
+	if striking.Date != "Jul 11, 2021" || striking.Opponent != "Dustin Poirier" || striking.Result != "L" {
+		t.Errorf("striking row %+v", striking)
+	}
+	if striking.TSL != "16" || striking.TSA != "41" || striking.TSL_TSA != "39%" || striking.PercentLeg != "42%" {
+		t.Errorf("striking values %+v", striking)
+	}
+	if clinch := mcgregor.ClinchStats[0]; clinch.SCBL != "2" || clinch.TK_ACC != "0%" {
+		t.Errorf("clinch values %+v", clinch)
+	}
+	if ground := mcgregor.GroundStats[0]; ground.SGHA != "1" {
+		t.Errorf("ground values %+v", ground)
+	}
+
+	var sources []string
+	sources = append(sources, mcgregor.SourceURLs...)
+	sort.Strings(sources)
+	wantSources := []string{
+		server.URL + "/mma/athletes/3022677",
+		server.URL + "/mma/athletes/3022677/fighthistory",
+		server.URL + "/mma/athletes/3022677/stats",
+	}
+	if len(sources) != len(wantSources) {
+		t.Fatalf("source URLs %v, want %v", sources, wantSources)
+	}
+	for i := range wantSources {
+		if sources[i] != wantSources[i] {
+			t.Errorf("source URL %s, want %s", sources[i], wantSources[i])
+		}
+	}
+
+	poirier, ok := fighters["dustin poirier"]
+	if !ok {
+		t.Fatalf("no dustin poirier in %v", fighters)
+	}
+	if poirier.ID != "2335639" || poirier.Team != "American Top Team" || len(poirier.Fights) != 1 || len(poirier.StrikingStats) != 1 {
+		t.Errorf("poirier %+v", poirier)
+	}
+}
+
+func TestESPNAPISourceFetchesOnlyRequestedAthletes(t *testing.T) {
+	server, requests := newTestESPNAPI(t)
+	fighters := crawlTestESPNAPI(t, server, "3022677")
+
+	if _, ok := fighters["conor mcgregor"]; len(fighters) != 1 || !ok {
+		t.Fatalf("fighters %v, want only conor mcgregor", fighters)
+	}
+	for _, request := range requests() {
+		if request == "/sb?dates=20210710" || strings.HasPrefix(request, "/mma/athletes/2335639") {
+			t.Errorf("requested %s", request)
+		}
+	}
+}
+
+// A fighter whose stats and fight history aren't found is still handed over by flush, with the
+// profile that was fetched. A fighter without even a profile is dropped.
+func TestESPNAPISourceFlushesIncompleteFighters(t *testing.T) {
+	server, _ := newTestESPNAPI(t)
+	fighters := crawlTestESPNAPI(t, server, "profile-only", "missing")
+
+	if len(fighters) != 1 {
+		t.Fatalf("fighters %v, want only the profile-only fighter", fighters)
+	}
+	for _, fighter := range fighters {
+		if fighter.ID != "profile-only" || fighter.LastName != "Profile" || len(fighter.Fights) != 0 {
+			t.Errorf("fighter %+v", fighter)
+		}
+	}
+}
+
+// The receiver gets its own copy of a complete fighter, and responses that arrive after the
+// hand-over don't change it
+func TestESPNAPISourceIgnoresLateUpdates(t *testing.T) {
+	var handedOver []*FighterStats
+	source := &espnAPISource{
+		fighters:  make(map[string]*apiFighter),
+		onFighter: func(fighterKey string, stats *FighterStats) { handedOver = append(handedOver, stats) },
+	}
+	for i := 0; i < apiPartCount; i++ {
+		source.update("3022677", true, func(stats *FighterStats) {
+			stats.ID, stats.FirstName, stats.LastName = "3022677", "Conor", "McGregor"
+			stats.SourceURLs = append(stats.SourceURLs, "https://api.example.com/athletes/3022677")
+		})
+	}
+	if len(handedOver) != 1 {
+		t.Fatalf("handed over %d times, want once", len(handedOver))
+	}
+
+	source.update("3022677", false, func(stats *FighterStats) {
+		stats.SourceURLs = append(stats.SourceURLs, "https://api.example.com/athletes/3022677/late")
+	})
+	source.flush()
+	if len(handedOver) != 1 {
+		t.Errorf("handed over %d times, want once", len(handedOver))
+	}
+	if got := handedOver[0].SourceURLs; len(got) != apiPartCount {
+		t.Errorf("source URLs %v, want the %d before the hand-over", got, apiPartCount)
+	}
+	if handedOver[0] == &source.fighters["3022677"].stats {
+		t.Error("the receiver got the source's own stats")
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSearchURL = "https://site.web.api.espn.com/apis/common/v3/search?sport=mma&type=player&limit=10&query="
+
+// fighterFetchAttempts is how often a page of a single fighter is tried before giving up
+const fighterFetchAttempts = 3
+
+// The backoff between attempts at a page of a single fighter, shortened by tests
+var fighterFetchBaseDelay, fighterFetchMaxDelay = 2 * time.Second, 30 * time.Second
+
+// newFighterClient is the HTTP client of a single-fighter scrape, with the same browser
+// identities and proxies as a crawl
+func newFighterClient() (*http.Client, error) {
+	transport, _, err := newScraperTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}, nil
+}
+
+// scrapeFighter fetches a fighter's stats and history pages, without crawling anything else,
+// and merges them into one record
+func scrapeFighter(client *http.Client, id, slug string) (*FighterStats, error) {
+	pageURLs := fighterPageURLs(id, slug)
+	type page struct {
+		key   string
+		stats FighterStats
+		err   error
+	}
+	pages := make([]page, len(pageURLs))
+	quarantine := newPageQuarantine("")
+
+	var wg sync.WaitGroup
+	for i, pageURL := range pageURLs {
+		wg.Add(1)
+		go func(i int, pageURL string) {
+			defer wg.Done()
+			finalURL, body, err := fetchPage(client, pageURL)
+			if err != nil {
+				pages[i].err = err
+				return
+			}
+			key, _, stats, issues, err := parseFighterPage(finalURL, body)
+			if err != nil {
+				// The other page may still have the fighter
+				quarantine.reportParseFailure(finalURL, body, err)
+				return
+			}
+			for _, issue := range issues {
+				log.Printf("Quality issue: %s", issue)
+			}
+			quarantine.saveEmptyTables(finalURL, body, issues)
+			pages[i].key, pages[i].stats = key, stats
+		}(i, pageURL)
+	}
+	wg.Wait()
+
+	// The stats page comes first, so its key, taken from the page header, wins. Pages that
+	// couldn't be fetched fail the scrape; pages that didn't parse were logged and are skipped.
+	var fighter *FighterStats
+	var fighterKey string
+	for i := range pages {
+		if pages[i].err != nil {
+			return nil, fmt.Errorf("%s: %v", pageURLs[i], pages[i].err)
+		}
+		if pages[i].key == "" {
+			continue
+		}
+		if fighter == nil {
+			fighter, fighterKey = &pages[i].stats, pages[i].key
+			continue
+		}
+		mergeFighter(fighter, &pages[i].stats, fighterKey)
+	}
+	if fighter == nil || fighter.FirstName == "" && fighter.LastName == "" {
+		return nil, fmt.Errorf("no fighter found with ID %s", id)
+	}
+	return fighter, nil
+}
+
+// fetchPage GETs a page, retrying network errors, bans and server errors with the crawl's
+// backoff. It returns the URL the page was finally served from, after redirects.
+func fetchPage(client *http.Client, pageURL string) (*url.URL, []byte, error) {
+	var lastErr error
+	var retryAfter time.Duration
+	for attempt := 1; attempt <= fighterFetchAttempts; attempt++ {
+		if attempt > 1 {
+			// A Retry-After longer than the backoff replaces it rather than adding to it
+			time.Sleep(max(backoffDelay(attempt-1, fighterFetchBaseDelay, fighterFetchMaxDelay), retryAfter))
+			retryAfter = 0
+		}
+		debugf("Visiting %s\n", pageURL)
+
+		resp, err := client.Get(pageURL)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return resp.Request.URL, body, nil
+		case resp.StatusCode == 429 || resp.StatusCode == 403 || resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("%s", resp.Status)
+			retryAfter, _ = parseRetryAfter(&resp.Header, time.Now())
+		default:
+			return nil, nil, fmt.Errorf("%s", resp.Status)
+		}
+	}
+	return nil, nil, fmt.Errorf("giving up after %d attempts: %v", fighterFetchAttempts, lastErr)
+}
+
+// resolveFighter turns an athlete ID, fighter page URL or name into an ID and name slug. Names
+// are looked up in the last snapshot first, MMA_OUTPUT_FILE or fighters.json, and then with
+// ESPN's search.
+func resolveFighter(client *http.Client, ref string) (string, string, error) {
+	if id, slug, err := parseFighterRef(ref); err == nil {
+		return id, slug, nil
+	}
+	if strings.Contains(ref, "://") {
+		return "", "", fmt.Errorf("%q is not an ESPN fighter URL", ref)
+	}
+
+	snapshotPath := os.Getenv("MMA_OUTPUT_FILE")
+	if snapshotPath == "" {
+		snapshotPath = defaultOutputFile
+	}
+	if snapshot, err := loadSnapshot(snapshotPath); err == nil {
+		id, err := findFighterID(snapshot.Fighters, ref)
+		if err != nil {
+			return "", "", err
+		}
+		if id != "" {
+			debugf("Found %s in %s with ID %s\n", ref, snapshotPath, id)
+			return id, "", nil
+		}
+		// Suggest close matches, in case the name is misspelled rather than missing
+		var fighters []*FighterStats
+		for i := range snapshot.Fighters {
+			fighters = append(fighters, &snapshot.Fighters[i])
+		}
+		for _, result := range newSearchIndex(fighters).search(ref, 3) {
+			log.Printf("Not found in %s, did you mean %s (%s)?", snapshotPath, fighterName(result.Fighter), fighterID(result.Fighter))
+		}
+	}
+
+	id, slug, err := searchFighter(client, ref)
+	if err != nil {
+		return "", "", fmt.Errorf("searching ESPN for %q: %v", ref, err)
+	}
+	return id, slug, nil
+}
+
+// findFighterID returns the ID of the fighter with the name in a snapshot, ignoring accents, or
+// "" when there is none. A name shared by several fighters is an error, listing their IDs.
+func findFighterID(fighters []FighterStats, name string) (string, error) {
+	name = nameKey(name)
+	var ids []string
+	for i := range fighters {
+		if fighters[i].ID != "" && nameKey(fighters[i].FirstName+" "+fighters[i].LastName) == name {
+			ids = append(ids, fighters[i].ID)
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return "", nil
+	case 1:
+		return ids[0], nil
+	}
+	return "", fmt.Errorf("%d fighters are called %s, use one of their IDs: %s", len(ids), name, strings.Join(ids, ", "))
+}
+
+// searchFighter asks ESPN's search, MMA_SEARCH_URL with the name appended, for a fighter and
+// returns the first fighter page it links to
+func searchFighter(client *http.Client, name string) (string, string, error) {
+	searchURL := os.Getenv("MMA_SEARCH_URL")
+	if searchURL == "" {
+		searchURL = defaultSearchURL
+	}
+	_, body, err := fetchPage(client, searchURL+url.QueryEscape(name))
+	if err != nil {
+		return "", "", err
+	}
+
+	var results interface{}
+	if err := json.Unmarshal(body, &results); err != nil {
+		return "", "", err
+	}
+	// The links sit at different depths depending on the kind of result, so look at every string
+	var id, slug string
+	var find func(value interface{}) bool
+	find = func(value interface{}) bool {
+		switch value := value.(type) {
+		case string:
+			var err error
+			if strings.Contains(value, "://") {
+				id, slug, err = parseFighterRef(value)
+				return err == nil
+			}
+		case []interface{}:
+			for _, v := range value {
+				if find(v) {
+					return true
+				}
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if find(value[key]) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if !find(results) {
+		return "", "", fmt.Errorf("no fighter found")
+	}
+	return id, slug, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestFetchServer answers each request with the next status of statuses, and with 200 and
+// the body "page" once they run out. It returns a function for the number of requests made.
+func newTestFetchServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, func() int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests <= len(statuses) {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(statuses[requests-1])
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+// shortenFetchDelays makes fetchPage retry without waiting long
+func shortenFetchDelays(t *testing.T, baseDelay, maxDelay time.Duration) {
+	oldBase, oldMax := fighterFetchBaseDelay, fighterFetchMaxDelay
+	fighterFetchBaseDelay, fighterFetchMaxDelay = baseDelay, maxDelay
+	t.Cleanup(func() { fighterFetchBaseDelay, fighterFetchMaxDelay = oldBase, oldMax })
+}
+
+func TestFetchPageRetries(t *testing.T) {
+	shortenFetchDelays(t, time.Millisecond, time.Millisecond)
+	server, requests := newTestFetchServer(t, nil, http.StatusServiceUnavailable, http.StatusForbidden)
+	_, body, err := fetchPage(http.DefaultClient, server.URL)
+	if err != nil || string(body) != "page" {
+		t.Fatalf("fetchPage = %q, %v, want the page", body, err)
+	}
+	if got := requests(); got != 3 {
+		t.Errorf("%d requests, want 3", got)
+	}
+}
+
+func TestFetchPageGivesUp(t *testing.T) {
+	shortenFetchDelays(t, time.Millisecond, time.Millisecond)
+	tests := []struct {
+		statuses []int
+		requests int
+		want     string
+	}{
+		// Bans and server errors are retried up to fighterFetchAttempts
+		{[]int{500, 502, 429, 200}, fighterFetchAttempts, "giving up after 3 attempts: 429"},
+		// Other errors aren't retried
+		{[]int{404}, 1, "404"},
+	}
+	for _, test := range tests {
+		server, requests := newTestFetchServer(t, nil, test.statuses...)
+		_, _, err := fetchPage(http.DefaultClient, server.URL)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("statuses %v: error %v, want %q", test.statuses, err, test.want)
+		}
+		if got := requests(); got != test.requests {
+			t.Errorf("statuses %v: %d requests, want %d", test.statuses, got, test.requests)
+		}
+	}
+}
+
+// Retry-After and the backoff aren't added up: the retry waits for the longer of the two
+func TestFetchPageWaitsOnceForRetryAfter(t *testing.T) {
+	shortenFetchDelays(t, time.Second, time.Second)
+	server, requests := newTestFetchServer(t, http.Header{"Retry-After": {"1"}}, http.StatusTooManyRequests)
+	start := time.Now()
+	if _, _, err := fetchPage(http.DefaultClient, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < time.Second || waited >= 1500*time.Millisecond {
+		t.Errorf("retried after %s, want the 1s of Retry-After", waited)
+	}
+	if got := requests(); got != 2 {
+		t.Errorf("%d requests, want 2", got)
+	}
+}
+
+// The URL returned is the one the page was served from, so an old slug that redirects is parsed
+// as the fighter's current page
+func TestFetchPageFollowsRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mma/fighter/stats/_/id/3022677/connor-mcgregor", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/mma/fighter/stats/_/id/3022677/conor-mcgregor", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/mma/fighter/stats/_/id/3022677/conor-mcgregor", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	finalURL, body, err := fetchPage(http.DefaultClient, server.URL+"/mma/fighter/stats/_/id/3022677/connor-mcgregor")
+	if err != nil || string(body) != "page" {
+		t.Fatalf("fetchPage = %q, %v, want the page", body, err)
+	}
+	if want := server.URL + "/mma/fighter/stats/_/id/3022677/conor-mcgregor"; finalURL.String() != want {
+		t.Errorf("final URL %s, want %s", finalURL, want)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// graphFight is a fight as seen from one fighter's record
+type graphFight struct {
+	fighter *FighterStats
+	fight   *Fight
+}
+
+// graphRequest is the body of a GraphQL POST
+type graphRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+type indexContextKey struct{}
+
+// indexFrom returns the index a request is answered from. Each request keeps the index it
+// started with, even if the data is reloaded while it runs.
+func indexFrom(p graphql.ResolveParams) *queryIndex {
+	return p.Context.Value(indexContextKey{}).(*queryIndex)
+}
+
+// newGraphQLSchema builds the schema over the query index. Field names are the JSON names of
+// fighters.json, so the two read the same.
+func newGraphQLSchema() (graphql.Schema, error) {
+	strikingType := statsObject("StrikingStats", "Striking stats of one fight", StrikingStats{})
+	clinchType := statsObject("ClinchStats", "Clinch stats of one fight", ClinchStats{})
+	groundType := statsObject("GroundStats", "Ground stats of one fight", GroundStats{})
+
+	var fighterType, fightType, boutType, cornerType, eventType *graphql.Object
+
+	pageArgs := graphql.FieldConfigArgument{
+		"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPerPage, Description: fmt.Sprintf("Items to return, up to %d", maxPerPage)},
+		"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0, Description: "Items to skip"},
+	}
+	withPageArgs := func(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+		for name, arg := range pageArgs {
+			args[name] = arg
+		}
+		return args
+	}
+
+	fighterType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Fighter",
+		Description: "A scraped fighter",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := graphql.Fields{
+				"id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Description: schemaDescriptions["id"], Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fighterID(p.Source.(*FighterStats)), nil
+				}},
+				"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "First and last name", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fighterName(p.Source.(*FighterStats)), nil
+				}},
+				"division": &graphql.Field{Type: graphql.String, Description: "Weight class by listed weight: the lightest UFC weight limit it fits", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return nullIfEmpty(fighterDivision(p.Source.(*FighterStats))), nil
+				}},
+				"scraped_at":     &graphql.Field{Type: graphql.DateTime, Description: schemaDescriptions["scraped_at"]},
+				"source_urls":    &graphql.Field{Type: graphql.NewList(graphql.String), Description: schemaDescriptions["source_urls"]},
+				"striking_stats": &graphql.Field{Type: graphql.NewList(strikingType), Description: schemaDescriptions["striking_stats"]},
+				"clinch_stats":   &graphql.Field{Type: graphql.NewList(clinchType), Description: schemaDescriptions["clinch_stats"]},
+				"ground_stats":   &graphql.Field{Type: graphql.NewList(groundType), Description: schemaDescriptions["ground_stats"]},
+				"fights": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(fightType))),
+					Description: "Fight history, most recent first",
+					Args: withPageArgs(graphql.FieldConfigArgument{
+						"result": &graphql.ArgumentConfig{Type: graphql.String, Description: "Only fights with this result, e.g. W"},
+					}),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						fighter := p.Source.(*FighterStats)
+						result, _ := p.Args["result"].(string)
+						var fights []*graphFight
+						for i := range fighter.Fights {
+							if result == "" || strings.EqualFold(fighter.Fights[i].Result, result) {
+								fights = append(fights, &graphFight{fighter, &fighter.Fights[i]})
+							}
+						}
+						return pageOf(fights, p.Args)
+					},
+				},
+				"bouts": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(boutType))),
+					Description: "Bouts with both sides' stats, most recent first",
+					Args: withPageArgs(graphql.FieldConfigArgument{
+						"opponent": &graphql.ArgumentConfig{Type: graphql.ID, Description: "Only bouts against this fighter"},
+					}),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						index := indexFrom(p)
+						id := fighterID(p.Source.(*FighterStats))
+						bouts := index.bouts[id]
+						if opponent, _ := p.Args["opponent"].(string); opponent != "" {
+							bouts = index.headToHead(id, opponent)
+						}
+						return pageOf(bouts, p.Args)
+					},
+				},
+			}
+			// The bio fields read straight from the struct
+			for _, name := range []string{"first_name", "last_name", "nickname", "height_and_weight", "birthdate", "team", "stance", "win_loss_record", "tko_record", "sub_record"} {
+				fields[name] = &graphql.Field{Type: graphql.String, Description: csvColumnDescriptions[name]}
+			}
+			return fields
+		}),
+	})
+
+	fightType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Fight",
+		Description: "A fight in a fighter's history",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := graphql.Fields{
+				"opponent": &graphql.Field{Type: fighterType, Description: "The opponent, if they were scraped", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if opponent := indexFrom(p).fighterByName(p.Source.(*graphFight).fight.Opponent); opponent != nil {
+						return opponent, nil
+					}
+					return nil, nil
+				}},
+				"opponent_name": &graphql.Field{Type: graphql.String, Description: "The opponent's name as listed", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*graphFight).fight.Opponent, nil
+				}},
+				"bout": &graphql.Field{Type: boutType, Description: "The bout, with both sides' stats", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					f := p.Source.(*graphFight)
+					_, _, boutID := boutIDs(fighterName(f.fighter), f.fight)
+					if bout, ok := indexFrom(p).boutsByID[boutID]; ok {
+						return bout, nil
+					}
+					return nil, nil
+				}},
+				"striking_stats": &graphql.Field{Type: strikingType, Description: "The fighter's striking stats in this fight", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fightStats(p, func(corner *boutCorner) interface{} { return corner.Striking })
+				}},
+				"clinch_stats": &graphql.Field{Type: clinchType, Description: "The fighter's clinch stats in this fight", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fightStats(p, func(corner *boutCorner) interface{} { return corner.Clinch })
+				}},
+				"ground_stats": &graphql.Field{Type: groundType, Description: "The fighter's ground stats in this fight", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fightStats(p, func(corner *boutCorner) interface{} { return corner.Ground })
+				}},
+			}
+			for _, name := range []string{"date", "event", "result", "decision", "rnd", "time"} {
+				fields[name] = &graphql.Field{Type: graphql.String, Description: csvColumnDescriptions[name], Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					p.Source = p.Source.(*graphFight).fight
+					return graphql.DefaultResolveFn(p)
+				}}
+			}
+			return fields
+		}),
+	})
+
+	cornerType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "BoutCorner",
+		Description: "One fighter's side of a bout",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"fighter": &graphql.Field{Type: fighterType, Description: "The fighter, if they were scraped", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if fighter, ok := indexFrom(p).byID[p.Source.(*boutCorner).ID]; ok {
+						return fighter, nil
+					}
+					return nil, nil
+				}},
+				"name":           &graphql.Field{Type: graphql.String},
+				"result":         &graphql.Field{Type: graphql.String, Description: "W, L or D; inferred from the other side for fighters who weren't scraped"},
+				"striking_stats": &graphql.Field{Type: strikingType},
+				"clinch_stats":   &graphql.Field{Type: clinchType},
+				"ground_stats":   &graphql.Field{Type: groundType},
+			}
+		}),
+	})
+
+	boutType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Bout",
+		Description: "A fight between two fighters, rebuilt from both of their records",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":       &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"date":     &graphql.Field{Type: graphql.String, Description: "YYYY-MM-DD"},
+				"decision": &graphql.Field{Type: graphql.String},
+				"round":    &graphql.Field{Type: graphql.String},
+				"time":     &graphql.Field{Type: graphql.String},
+				"event": &graphql.Field{Type: eventType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return indexFrom(p).eventsByID[p.Source.(*queryBout).EventID], nil
+				}},
+				"fighters": &graphql.Field{Type: graphql.NewList(cornerType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					bout := p.Source.(*queryBout)
+					return []*boutCorner{&bout.Corners[0], &bout.Corners[1]}, nil
+				}},
+			}
+		}),
+	})
+
+	eventType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Event",
+		Description: "An event card, identified by its date and name",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"name":  &graphql.Field{Type: graphql.String},
+				"date":  &graphql.Field{Type: graphql.String, Description: "YYYY-MM-DD"},
+				"bouts": &graphql.Field{Type: graphql.NewList(boutType)},
+			}
+		}),
+	})
+
+	fighterPageType := pageObject("FighterPage", fighterType)
+	eventPageType := pageObject("EventPage", eventType)
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"fighter": &graphql.Field{
+				Type:        fighterType,
+				Description: "A fighter by ID or name",
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.ID},
+					"name": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					index := indexFrom(p)
+					if id, _ := p.Args["id"].(string); id != "" {
+						if fighter, ok := index.byID[id]; ok {
+							return fighter, nil
+						}
+						return nil, nil
+					}
+					if name, _ := p.Args["name"].(string); name != "" {
+						if fighter := index.fighterByName(name); fighter != nil {
+							return fighter, nil
+						}
+						return nil, nil
+					}
+					return nil, fmt.Errorf("fighter needs an id or a name")
+				},
+			},
+			"fighters": &graphql.Field{
+				Type:        fighterPageType,
+				Description: "Fighters sorted by name, or by how well they match q",
+				Args: withPageArgs(graphql.FieldConfigArgument{
+					"q":        &graphql.ArgumentConfig{Type: graphql.String, Description: "Name, nickname or alias to search for; results are ranked best match first"},
+					"division": &graphql.ArgumentConfig{Type: graphql.String},
+					"stance":   &graphql.ArgumentConfig{Type: graphql.String},
+					"team":     &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter := fighterFilter{}
+					filter.Query, _ = p.Args["q"].(string)
+					filter.Division, _ = p.Args["division"].(string)
+					filter.Stance, _ = p.Args["stance"].(string)
+					filter.Team, _ = p.Args["team"].(string)
+					found, _ := indexFrom(p).findFighters(filter)
+					nodes, err := pageOf(found, p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return map[string]interface{}{"total": len(found), "nodes": nodes}, nil
+				},
+			},
+			"event": &graphql.Field{
+				Type: eventType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if event, ok := indexFrom(p).eventsByID[p.Args["id"].(string)]; ok {
+						return event, nil
+					}
+					return nil, nil
+				},
+			},
+			"events": &graphql.Field{
+				Type:        eventPageType,
+				Description: "Events, most recent first",
+				Args:        withPageArgs(graphql.FieldConfigArgument{}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					events := indexFrom(p).events
+					nodes, err := pageOf(events, p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return map[string]interface{}{"total": len(events), "nodes": nodes}, nil
+				},
+			},
+			"bout": &graphql.Field{
+				Type: boutType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if bout, ok := indexFrom(p).boutsByID[p.Args["id"].(string)]; ok {
+						return bout, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// statsObject describes one of the per-fight stats structs, field for field
+func statsObject(name, description string, stats interface{}) *graphql.Object {
+	fields := graphql.Fields{}
+	t := reflect.TypeOf(stats)
+	for i := 0; i < t.NumField(); i++ {
+		jsonName := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		fields[jsonName] = &graphql.Field{Type: graphql.String, Description: csvColumnDescriptions[jsonName]}
+	}
+	return graphql.NewObject(graphql.ObjectConfig{Name: name, Description: description, Fields: fields})
+}
+
+// pageObject is a page of a list with the total number of items
+func pageObject(name string, nodeType *graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Fields: graphql.Fields{
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "Number of items across all pages"},
+			"nodes": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(nodeType)))},
+		},
+	})
+}
+
+// pageOf applies the first and offset arguments to a list
+func pageOf[T any](items []T, args map[string]interface{}) ([]T, error) {
+	first, _ := args["first"].(int)
+	offset, _ := args["offset"].(int)
+	if first < 0 || first > maxPerPage || offset < 0 {
+		return nil, fmt.Errorf("first must be 0 to %d and offset at least 0", maxPerPage)
+	}
+	if offset >= len(items) {
+		return []T{}, nil
+	}
+	end := offset + first
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end], nil
+}
+
+// fightStats returns one of the fighter's stats rows for a fight, from its bout
+func fightStats(p graphql.ResolveParams, row func(corner *boutCorner) interface{}) (interface{}, error) {
+	f := p.Source.(*graphFight)
+	_, _, boutID := boutIDs(fighterName(f.fighter), f.fight)
+	bout, ok := indexFrom(p).boutsByID[boutID]
+	if !ok {
+		return nil, nil
+	}
+	for i := range bout.Corners {
+		if bout.Corners[i].ID == fighterID(f.fighter) {
+			if value := row(&bout.Corners[i]); !reflect.ValueOf(value).IsNil() {
+				return value, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// Limits on a GraphQL request. The schema is recursive (a fight's opponent has fights, whose
+// opponents have fights...) and every list returns up to maxPerPage items, so without a depth
+// limit one query could make the server walk millions of objects.
+const (
+	maxQueryDepth  = 6
+	maxGraphQLBody = 64 << 10
+)
+
+// queryDepth is how deeply a query's fields nest, counting the fields of the fragments it
+// spreads. A query that doesn't parse has depth 0; graphql.Do reports the syntax error.
+func queryDepth(query string) int {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return 0
+	}
+	fragments := make(map[string]*ast.SelectionSet)
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok && fragment.Name != nil {
+			fragments[fragment.Name.Value] = fragment.SelectionSet
+		}
+	}
+
+	var depth func(set *ast.SelectionSet, spread map[string]bool) int
+	depth = func(set *ast.SelectionSet, spread map[string]bool) int {
+		if set == nil {
+			return 0
+		}
+		deepest := 0
+		for _, selection := range set.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				deepest = max(deepest, 1+depth(selection.SelectionSet, spread))
+			case *ast.InlineFragment:
+				deepest = max(deepest, depth(selection.SelectionSet, spread))
+			case *ast.FragmentSpread:
+				// A fragment that spreads itself is an error graphql.Do reports
+				name := selection.Name.Value
+				if !spread[name] {
+					spread[name] = true
+					deepest = max(deepest, depth(fragments[name], spread))
+					delete(spread, name)
+				}
+			}
+		}
+		return deepest
+	}
+
+	deepest := 0
+	for _, definition := range doc.Definitions {
+		if operation, ok := definition.(*ast.OperationDefinition); ok {
+			deepest = max(deepest, depth(operation.SelectionSet, make(map[string]bool)))
+		}
+	}
+	return deepest
+}
+
+// handleGraphQL answers GraphQL queries sent as a POST body or as ?query= on a GET
+func (s *queryServer) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var request graphRequest
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxGraphQLBody)
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("GraphQL requests are limited to %d bytes", maxGraphQLBody))
+				return
+			}
+			writeError(w, http.StatusBadRequest, "invalid GraphQL request: "+err.Error())
+			return
+		}
+	} else {
+		request.Query = r.URL.Query().Get("query")
+		request.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid variables: "+err.Error())
+				return
+			}
+		}
+	}
+	if request.Query == "" {
+		writeError(w, http.StatusBadRequest, "no GraphQL query")
+		return
+	}
+	if depth := queryDepth(request.Query); depth > maxQueryDepth {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("query is nested %d levels deep, the limit is %d", depth, maxQueryDepth))
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        context.WithValue(r.Context(), indexContextKey{}, s.current()),
+	})
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestQueryDepth(t *testing.T) {
+	tests := []struct {
+		query string
+		depth int
+	}{
+		{`{ fighter(id: "1") { name } }`, 2},
+		{`{ fighter(id: "1") { fights { opponent { name } } } }`, 4},
+		{`{ fighter(id: "1") { ...card } } fragment card on Fighter { fights { date } }`, 3},
+		{`{ fighter(id: "1") { ... on Fighter { fights { date } } } }`, 3},
+		{`{ fighter(id: "1") { ...loop } } fragment loop on Fighter { fights { opponent { ...loop } } }`, 3},
+		{`{ fighter(`, 0},
+	}
+	for _, test := range tests {
+		if depth := queryDepth(test.query); depth != test.depth {
+			t.Errorf("queryDepth(%q) = %d, want %d", test.query, depth, test.depth)
+		}
+	}
+}
+
+func TestGraphQLAnswersQueries(t *testing.T) {
+	server := newTestQueryServer(t)
+	status, result := postGraphQL(t, server, `{ fighter(id: "3022677") { name fights { result opponent { name } } } }`)
+	if status != http.StatusOK {
+		t.Fatalf("status %d, want 200: %v", status, result)
+	}
+	fighter := result["data"].(map[string]interface{})["fighter"].(map[string]interface{})
+	fights := fighter["fights"].([]interface{})
+	opponent := fights[0].(map[string]interface{})["opponent"].(map[string]interface{})
+	if fighter["name"] != "Conor McGregor" || opponent["name"] != "Dustin Poirier" {
+		t.Errorf("got %v", fighter)
+	}
+}
+
+func TestGraphQLRefusesDeepQueries(t *testing.T) {
+	server := newTestQueryServer(t)
+
+	// Every fights/opponent level multiplies the work by up to maxPerPage
+	query := `{ fighter(id: "3022677") { fights(first: 100) { opponent { fights(first: 100) { opponent { fights(first: 100) { opponent { name } } } } } } } }`
+	status, result := postGraphQL(t, server, query)
+	if status != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %v", status, result)
+	}
+	if message, _ := result["error"].(string); !strings.Contains(message, "levels deep") {
+		t.Errorf("error %q doesn't mention the depth", message)
+	}
+
+	// A fragment doesn't get around the limit
+	query = `{ fighter(id: "3022677") { ...deep } } fragment deep on Fighter { fights { opponent { fights { opponent { fights { opponent { name } } } } } } }`
+	if status, result := postGraphQL(t, server, query); status != http.StatusBadRequest {
+		t.Errorf("fragment: status %d, want 400: %v", status, result)
+	}
+}
+
+func TestGraphQLLimitsBodySize(t *testing.T) {
+	server := newTestQueryServer(t)
+	body := `{"query": "{ fighters { total } }", "padding": "` + strings.Repeat("x", maxGraphQLBody) + `"}`
+	resp, err := http.Post(server.URL+"/api/graphql", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413", resp.StatusCode)
+	}
+}
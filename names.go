@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldedLetters are letters that don't decompose into a base letter and an accent, spelled the
+// way English-language sources write them
+var foldedLetters = map[rune]string{
+	'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ß': "ss",
+	'æ': "ae", 'œ': "oe", 'ı': "i", 'ħ': "h", 'ŀ': "l",
+}
+
+// foldName reduces a name to lowercase ASCII words for matching: accents are dropped, so
+// "José Aldo" and "Jose Aldo" fold the same, and punctuation and hyphens separate words
+func foldName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// A combining accent, dropped
+			continue
+		case r == '\'' || r == '’' || r == '.':
+			// O'Malley and O’Malley match OMalley, and initials keep their letters together
+			continue
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		case foldedLetters[r] != "":
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(foldedLetters[r])
+			space = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			// Scripts without an ASCII spelling are kept as they are
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// nameKey is the key a fighter is matched and stored under: the folded name, so that the
+// stats page header, the history page URL and an opponent column all give the same key for
+// "Jan Błachowicz", "jan-blachowicz" and "Jan Blachowicz"
+func nameKey(name string) string {
+	return foldName(name)
+}
+
+// displayName tidies a name for display without changing how it is written: whitespace is
+// collapsed and accents are composed. Only names written in one case, such as "CONOR MCGREGOR"
+// or a name rebuilt from a URL, are recapitalized with capitalizeName.
+func displayName(name string) string {
+	name = strings.Join(strings.Fields(norm.NFC.String(name)), " ")
+	hasUpper, hasLower := false, false
+	for _, r := range name {
+		hasUpper = hasUpper || unicode.IsUpper(r)
+		hasLower = hasLower || unicode.IsLower(r)
+	}
+	if hasUpper && hasLower {
+		return name
+	}
+	return capitalizeName(name)
+}
+
+// nameParticles stay lowercase inside a name, as in "Rafael dos Anjos" or "Germaine de
+// Randamie". The first word of a name is always capitalized.
+var nameParticles = map[string]bool{
+	"da": true, "das": true, "de": true, "del": true, "della": true, "der": true, "di": true,
+	"do": true, "dos": true, "du": true, "e": true, "la": true, "le": true, "ten": true,
+	"ter": true, "van": true, "von": true, "y": true, "bin": true, "ibn": true,
+}
+
+// nameSpellings are words whose capitalization no rule gets right, such as initials written
+// without dots
+var nameSpellings = map[string]string{
+	"aj":         "AJ",
+	"bj":         "BJ",
+	"cb":         "CB",
+	"cj":         "CJ",
+	"dj":         "DJ",
+	"jj":         "JJ",
+	"kj":         "KJ",
+	"rj":         "RJ",
+	"tj":         "TJ",
+	"macdonald":  "MacDonald",
+	"macfarlane": "Macfarlane",
+	"mckenzie":   "McKenzie",
+	"jr":         "Jr.",
+	"jr.":        "Jr.",
+	"sr":         "Sr.",
+	"sr.":        "Sr.",
+}
+
+// capitalizeName capitalizes a name written in one case. Beyond capitalizing each word, it
+// keeps particles lowercase, capitalizes after Mc ("McGregor"), after an O' or D' ("O'Malley")
+// and in each part of a hyphenated name ("Marc-André"), and writes roman numerals in capitals
+// ("II"). Unlike strings.Title, it handles letters outside ASCII, such as the Ł of Łukasz.
+func capitalizeName(name string) string {
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		switch {
+		case nameSpellings[word] != "":
+			words[i] = nameSpellings[word]
+		case i > 0 && nameParticles[word]:
+		case i > 0 && isRomanNumeral(word):
+			words[i] = strings.ToUpper(word)
+		default:
+			parts := strings.Split(word, "-")
+			for j, part := range parts {
+				parts[j] = capitalizeNamePart(part)
+			}
+			words[i] = strings.Join(parts, "-")
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalizeNamePart capitalizes one word of a name, or one part of a hyphenated word
+func capitalizeNamePart(part string) string {
+	runes := []rune(part)
+	if len(runes) == 0 {
+		return part
+	}
+	runes[0] = unicode.ToTitle(runes[0])
+	for i := 1; i < len(runes); i++ {
+		switch {
+		case runes[i-1] == '.':
+			// The next initial, as in B.J.
+			runes[i] = unicode.ToTitle(runes[i])
+		case i == 2 && (runes[1] == '\'' || runes[1] == '’'):
+			// O'Malley, D'Angelo
+			runes[i] = unicode.ToTitle(runes[i])
+		}
+	}
+	if len(runes) > 2 && runes[0] == 'M' && runes[1] == 'c' {
+		runes[2] = unicode.ToTitle(runes[2])
+	}
+	return string(runes)
+}
+
+func isRomanNumeral(word string) bool {
+	switch word {
+	case "ii", "iii", "iv", "v", "vi":
+		return true
+	}
+	return false
+}
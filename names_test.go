@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		// Names in mixed case are kept as ESPN writes them
+		{"Conor McGregor", "Conor McGregor"},
+		{"Jan Błachowicz", "Jan Błachowicz"},
+		{"  Rafael   dos Anjos ", "Rafael dos Anjos"},
+		{"José Aldo", "José Aldo"},
+
+		// Names in one case are recapitalized
+		{"CONOR MCGREGOR", "Conor McGregor"},
+		{"conor mcgregor", "Conor McGregor"},
+		{"RAFAEL DOS ANJOS", "Rafael dos Anjos"},
+		{"germaine de randamie", "Germaine de Randamie"},
+		{"sean o'malley", "Sean O'Malley"},
+		{"SEAN O’MALLEY", "Sean O’Malley"},
+		{"JAN BŁACHOWICZ", "Jan Błachowicz"},
+		{"łukasz jurkowski", "Łukasz Jurkowski"},
+		{"marc-andré barriault", "Marc-André Barriault"},
+		{"MARC-ANDRÉ BARRIAULT", "Marc-André Barriault"},
+		{"jose aldo jr", "Jose Aldo Jr."},
+		{"ANTHONY PETTIS SR.", "Anthony Pettis Sr."},
+		{"john smith ii", "John Smith II"},
+		{"JOHN SMITH IV", "John Smith IV"},
+		{"b.j. penn", "B.J. Penn"},
+		{"TJ DILLASHAW", "TJ Dillashaw"},
+		{"bj penn", "BJ Penn"},
+		{"dos santos", "Dos Santos"}, // The first word is always capitalized
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := displayName(test.name); got != test.want {
+			t.Errorf("displayName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNameKey(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Conor McGregor", "conor mcgregor"},
+		{"CONOR MCGREGOR", "conor mcgregor"},
+		{"conor-mcgregor", "conor mcgregor"},
+		{"Jan Błachowicz", "jan blachowicz"},
+		{"jan-blachowicz", "jan blachowicz"},
+		{"José Aldo", "jose aldo"},
+		{"José Aldo", "jose aldo"},
+		{"Marc-André Barriault", "marc andre barriault"},
+		{"Sean O'Malley", "sean omalley"},
+		{"Sean O’Malley", "sean omalley"},
+		{"B.J. Penn", "bj penn"},
+		{"Jose Aldo Jr.", "jose aldo jr"},
+		{"Khabib Nurmagomedov  ", "khabib nurmagomedov"},
+		{"Ørjan Dæhli", "orjan daehli"},
+		{"Zhang Weili 张伟丽", "zhang weili 张伟丽"},
+		{" - ", ""},
+	}
+	for _, test := range tests {
+		if got := nameKey(test.name); got != test.want {
+			t.Errorf("nameKey(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// The key of a name rebuilt for display is the key it started with, so a page whose name came
+// from its URL merges with the page whose name came from its header
+func TestDisplayNameKeepsKey(t *testing.T) {
+	for _, name := range []string{"conor mcgregor", "rafael dos anjos", "sean o'malley", "jan błachowicz", "tj dillashaw"} {
+		if got := nameKey(capitalizeName(name)); got != nameKey(name) {
+			t.Errorf("nameKey(capitalizeName(%q)) = %q, want %q", name, got, nameKey(name))
+		}
+	}
+}
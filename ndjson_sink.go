@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+)
+
+const defaultNDJSONFile = "fighters.ndjson"
+
+// ndjsonSink writes newline-delimited JSON, one fighter per line. During the crawl each fighter
+// is appended as soon as it is complete, so the file can be tailed or loaded before the run
+// ends. A fighter that is merged again later can show up on more than one line; at the end of
+// the run the file is compacted so that it holds every fighter exactly once.
+//
+// Streaming makes the fighters available sooner, but it doesn't save memory: the crawl still
+// keeps every fighter until the end, because the other sinks, the quality checks and the
+// duplicate check all need the full list, and compaction is written from that list.
+type ndjsonSink struct {
+	Path string
+
+	mu       sync.Mutex
+	file     *os.File
+	streamed int
+}
+
+func (s *ndjsonSink) Name() string {
+	return "ndjson " + s.Path
+}
+
+// WriteFighter appends one fighter to the file, starting a new file for the first fighter
+// of the run. Each line goes out in a single write, so readers never see half a fighter.
+func (s *ndjsonSink) WriteFighter(fighter FighterStats) error {
+	jsonData, err := json.Marshal(fighter)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		s.file, err = os.OpenFile(s.Path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := s.file.Write(append(jsonData, '\n')); err != nil {
+		return err
+	}
+	s.streamed++
+	return nil
+}
+
+// Write is the compaction step: it replaces the streamed file with the final fighters, which
+// include fighters that were never complete enough to stream
+func (s *ndjsonSink) Write(fighters []FighterStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	// Write next to the stream and rename over it, so the file is never left half written
+	tmpPath := s.Path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for i := range fighters {
+		if err := encoder.Encode(&fighters[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.Path); err != nil {
+		return err
+	}
+
+	log.Printf("Compacted %d streamed lines into %d fighters in %s", s.streamed, len(fighters), s.Path)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readNDJSON returns the last names on the lines of an NDJSON file
+func readNDJSON(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lastNames []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var fighter FighterStats
+		if err := json.Unmarshal(scanner.Bytes(), &fighter); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		lastNames = append(lastNames, fighter.LastName)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lastNames
+}
+
+func TestNDJSONSinkStreamsAndCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fighters.ndjson")
+	// A file left by an earlier run is replaced, not appended to
+	if err := os.WriteFile(path, []byte("{\"LastName\":\"Old\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &ndjsonSink{Path: path}
+	fighters := testFighters("One", "Two")
+	for _, fighter := range []FighterStats{fighters[0], fighters[1], fighters[0]} {
+		if err := sink.WriteFighter(fighter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Every streamed line can be read before the run ends, repeats included
+	if got := readNDJSON(t, path); len(got) != 3 || got[0] != "One" || got[1] != "Two" || got[2] != "One" {
+		t.Errorf("streamed lines %v, want One, Two, One", got)
+	}
+
+	// Compaction writes the final fighters once each, with fighters that were never streamed
+	if err := sink.Write(testFighters("One", "Two", "Three")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNDJSON(t, path); len(got) != 3 || got[0] != "One" || got[1] != "Two" || got[2] != "Three" {
+		t.Errorf("compacted lines %v, want One, Two, Three", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file was left behind (%v)", err)
+	}
+}
+
+// A run with nothing streamed still writes the file, through the temporary file
+func TestNDJSONSinkWritesWithoutStreaming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fighters.ndjson")
+	sink := &ndjsonSink{Path: path}
+	if err := sink.Write(testFighters("One")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNDJSON(t, path); len(got) != 1 || got[0] != "One" {
+		t.Errorf("lines %v, want One", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file was left behind (%v)", err)
+	}
+}
+
+// When the temporary file can't be renamed over the stream, the streamed file is left as it was
+func TestNDJSONSinkKeepsStreamWhenCompactionFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fighters.ndjson")
+	sink := &ndjsonSink{Path: path}
+	if err := sink.WriteFighter(testFighters("One")[0]); err != nil {
+		t.Fatal(err)
+	}
+	// A directory in the way of the temporary file makes the compaction fail
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(testFighters("One", "Two")); err == nil {
+		t.Fatal("no error with the temporary file blocked")
+	}
+	if got := readNDJSON(t, path); len(got) != 1 || got[0] != "One" {
+		t.Errorf("lines %v, want the streamed One", got)
+	}
+}
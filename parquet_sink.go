@@ -0,0 +1,333 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const defaultParquetDir = "parquet"
+
+// parquetSink writes the fighters as Parquet files with the same tables as the CSV sink, but
+// with typed columns: counts are integers, percentages are doubles and dates are DATE columns.
+// Landed/attempted pairs such as "5/12" are split into two columns. Values that are missing or
+// don't parse are written as nulls.
+type parquetSink struct {
+	Dir string
+}
+
+type parquetFighter struct {
+	FighterID string   `parquet:"name=fighter_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FirstName string   `parquet:"name=first_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LastName  string   `parquet:"name=last_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Nickname  string   `parquet:"name=nickname, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Team      string   `parquet:"name=team, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Stance    string   `parquet:"name=stance, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Birthdate *int32   `parquet:"name=birthdate, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	HeightIn  *int32   `parquet:"name=height_in, type=INT32, repetitiontype=OPTIONAL"`
+	WeightLbs *float64 `parquet:"name=weight_lbs, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Wins      *int32   `parquet:"name=wins, type=INT32, repetitiontype=OPTIONAL"`
+	Losses    *int32   `parquet:"name=losses, type=INT32, repetitiontype=OPTIONAL"`
+	Draws     *int32   `parquet:"name=draws, type=INT32, repetitiontype=OPTIONAL"`
+	TKOWins   *int32   `parquet:"name=tko_wins, type=INT32, repetitiontype=OPTIONAL"`
+	TKOLosses *int32   `parquet:"name=tko_losses, type=INT32, repetitiontype=OPTIONAL"`
+	SubWins   *int32   `parquet:"name=sub_wins, type=INT32, repetitiontype=OPTIONAL"`
+	SubLosses *int32   `parquet:"name=sub_losses, type=INT32, repetitiontype=OPTIONAL"`
+}
+
+type parquetFight struct {
+	FighterID   string `parquet:"name=fighter_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Position    int32  `parquet:"name=position, type=INT32"`
+	Date        *int32 `parquet:"name=date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	Opponent    string `parquet:"name=opponent, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Event       string `parquet:"name=event, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Result      string `parquet:"name=result, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Decision    string `parquet:"name=decision, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Rnd         *int32 `parquet:"name=rnd, type=INT32, repetitiontype=OPTIONAL"`
+	TimeSeconds *int32 `parquet:"name=time_seconds, type=INT32, repetitiontype=OPTIONAL"`
+}
+
+type parquetStriking struct {
+	FighterID     string   `parquet:"name=fighter_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Position      int32    `parquet:"name=position, type=INT32"`
+	Date          *int32   `parquet:"name=date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	Opponent      string   `parquet:"name=opponent, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Event         string   `parquet:"name=event, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Result        string   `parquet:"name=result, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SDBLLanded    *int32   `parquet:"name=sdbl_landed, type=INT32, repetitiontype=OPTIONAL"`
+	SDBLAttempted *int32   `parquet:"name=sdbl_attempted, type=INT32, repetitiontype=OPTIONAL"`
+	SDHLLanded    *int32   `parquet:"name=sdhl_landed, type=INT32, repetitiontype=OPTIONAL"`
+	SDHLAttempted *int32   `parquet:"name=sdhl_attempted, type=INT32, repetitiontype=OPTIONAL"`
+	SDLLLanded    *int32   `parquet:"name=sdll_landed, type=INT32, repetitiontype=OPTIONAL"`
+	SDLLAttempted *int32   `parquet:"name=sdll_attempted, type=INT32, repetitiontype=OPTIONAL"`
+	TSL           *int32   `parquet:"name=tsl, type=INT32, repetitiontype=OPTIONAL"`
+	TSA           *int32   `parquet:"name=tsa, type=INT32, repetitiontype=OPTIONAL"`
+	SSL           *int32   `parquet:"name=ssl, type=INT32, repetitiontype=OPTIONAL"`
+	SSA           *int32   `parquet:"name=ssa, type=INT32, repetitiontype=OPTIONAL"`
+	TSLTSA        *float64 `parquet:"name=tsl_tsa, type=DOUBLE, repetitiontype=OPTIONAL"`
+	KD            *int32   `parquet:"name=kd, type=INT32, repetitiontype=OPTIONAL"`
+	PercentBody   *float64 `parquet:"name=percent_body, type=DOUBLE, repetitiontype=OPTIONAL"`
+	PercentHead   *float64 `parquet:"name=percent_head, type=DOUBLE, repetitiontype=OPTIONAL"`
+	PercentLeg    *float64 `parquet:"name=percent_leg, type=DOUBLE, repetitiontype=OPTIONAL"`
+}
+
+type parquetClinch struct {
+	FighterID string   `parquet:"name=fighter_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Position  int32    `parquet:"name=position, type=INT32"`
+	Date      *int32   `parquet:"name=date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	Opponent  string   `parquet:"name=opponent, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Event     string   `parquet:"name=event, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Result    string   `parquet:"name=result, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SCBL      *int32   `parquet:"name=scbl, type=INT32, repetitiontype=OPTIONAL"`
+	SCBA      *int32   `parquet:"name=scba, type=INT32, repetitiontype=OPTIONAL"`
+	SCHL      *int32   `parquet:"name=schl, type=INT32, repetitiontype=OPTIONAL"`
+	SCHA      *int32   `parquet:"name=scha, type=INT32, repetitiontype=OPTIONAL"`
+	SCLL      *int32   `parquet:"name=scll, type=INT32, repetitiontype=OPTIONAL"`
+	SCLA      *int32   `parquet:"name=scla, type=INT32, repetitiontype=OPTIONAL"`
+	RV        *int32   `parquet:"name=rv, type=INT32, repetitiontype=OPTIONAL"`
+	SR        *float64 `parquet:"name=sr, type=DOUBLE, repetitiontype=OPTIONAL"`
+	TDL       *int32   `parquet:"name=tdl, type=INT32, repetitiontype=OPTIONAL"`
+	TDA       *int32   `parquet:"name=tda, type=INT32, repetitiontype=OPTIONAL"`
+	TDS       *int32   `parquet:"name=tds, type=INT32, repetitiontype=OPTIONAL"`
+	TKAcc     *float64 `parquet:"name=tk_acc, type=DOUBLE, repetitiontype=OPTIONAL"`
+}
+
+type parquetGround struct {
+	FighterID string `parquet:"name=fighter_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Position  int32  `parquet:"name=position, type=INT32"`
+	Date      *int32 `parquet:"name=date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	Opponent  string `parquet:"name=opponent, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Event     string `parquet:"name=event, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Result    string `parquet:"name=result, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SGBL      *int32 `parquet:"name=sgbl, type=INT32, repetitiontype=OPTIONAL"`
+	SGBA      *int32 `parquet:"name=sgba, type=INT32, repetitiontype=OPTIONAL"`
+	SGHL      *int32 `parquet:"name=sghl, type=INT32, repetitiontype=OPTIONAL"`
+	SGHA      *int32 `parquet:"name=sgha, type=INT32, repetitiontype=OPTIONAL"`
+	SGLL      *int32 `parquet:"name=sgll, type=INT32, repetitiontype=OPTIONAL"`
+	SGLA      *int32 `parquet:"name=sgla, type=INT32, repetitiontype=OPTIONAL"`
+	AD        *int32 `parquet:"name=ad, type=INT32, repetitiontype=OPTIONAL"`
+	ADTB      *int32 `parquet:"name=adtb, type=INT32, repetitiontype=OPTIONAL"`
+	ADHG      *int32 `parquet:"name=adhg, type=INT32, repetitiontype=OPTIONAL"`
+	ADTM      *int32 `parquet:"name=adtm, type=INT32, repetitiontype=OPTIONAL"`
+	ADTS      *int32 `parquet:"name=adts, type=INT32, repetitiontype=OPTIONAL"`
+	SM        *int32 `parquet:"name=sm, type=INT32, repetitiontype=OPTIONAL"`
+}
+
+func (s *parquetSink) Name() string {
+	return "parquet " + s.Dir
+}
+
+func (s *parquetSink) Write(fighters []FighterStats) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	var fighterRows, fightRows, strikingRows, clinchRows, groundRows []interface{}
+	for i := range fighters {
+		fighter := &fighters[i]
+		id := fighterID(fighter)
+
+		fighterRows = append(fighterRows, parquetFighterRow(id, fighter))
+		for position, fight := range fighter.Fights {
+			fightRows = append(fightRows, &parquetFight{
+				FighterID:   id,
+				Position:    int32(position),
+				Date:        parquetDate(fight.Date),
+				Opponent:    fight.Opponent,
+				Event:       fight.Event,
+				Result:      fight.Result,
+				Decision:    fight.Decision,
+				Rnd:         parquetInt(fight.Rnd),
+				TimeSeconds: parquetFightTime(fight.Time),
+			})
+		}
+		for position, stats := range fighter.StrikingStats {
+			row := &parquetStriking{
+				FighterID:   id,
+				Position:    int32(position),
+				Date:        parquetDate(stats.Date),
+				Opponent:    stats.Opponent,
+				Event:       stats.Event,
+				Result:      stats.Result,
+				TSL:         parquetInt(stats.TSL),
+				TSA:         parquetInt(stats.TSA),
+				SSL:         parquetInt(stats.SSL),
+				SSA:         parquetInt(stats.SSA),
+				TSLTSA:      parquetFloat(stats.TSL_TSA),
+				KD:          parquetInt(stats.KD),
+				PercentBody: parquetFloat(stats.PercentBody),
+				PercentHead: parquetFloat(stats.PercentHead),
+				PercentLeg:  parquetFloat(stats.PercentLeg),
+			}
+			row.SDBLLanded, row.SDBLAttempted = parquetLandedAttempted(stats.SDblA)
+			row.SDHLLanded, row.SDHLAttempted = parquetLandedAttempted(stats.SDhlA)
+			row.SDLLLanded, row.SDLLAttempted = parquetLandedAttempted(stats.SDllA)
+			strikingRows = append(strikingRows, row)
+		}
+		for position, stats := range fighter.ClinchStats {
+			clinchRows = append(clinchRows, &parquetClinch{
+				FighterID: id,
+				Position:  int32(position),
+				Date:      parquetDate(stats.Date),
+				Opponent:  stats.Opponent,
+				Event:     stats.Event,
+				Result:    stats.Result,
+				SCBL:      parquetInt(stats.SCBL),
+				SCBA:      parquetInt(stats.SCBA),
+				SCHL:      parquetInt(stats.SCHL),
+				SCHA:      parquetInt(stats.SCHA),
+				SCLL:      parquetInt(stats.SCLL),
+				SCLA:      parquetInt(stats.SCLA),
+				RV:        parquetInt(stats.RV),
+				SR:        parquetFloat(stats.SR),
+				TDL:       parquetInt(stats.TDL),
+				TDA:       parquetInt(stats.TDA),
+				TDS:       parquetInt(stats.TDS),
+				TKAcc:     parquetFloat(stats.TK_ACC),
+			})
+		}
+		for position, stats := range fighter.GroundStats {
+			groundRows = append(groundRows, &parquetGround{
+				FighterID: id,
+				Position:  int32(position),
+				Date:      parquetDate(stats.Date),
+				Opponent:  stats.Opponent,
+				Event:     stats.Event,
+				Result:    stats.Result,
+				SGBL:      parquetInt(stats.SGBL),
+				SGBA:      parquetInt(stats.SGBA),
+				SGHL:      parquetInt(stats.SGHL),
+				SGHA:      parquetInt(stats.SGHA),
+				SGLL:      parquetInt(stats.SGLL),
+				SGLA:      parquetInt(stats.SGLA),
+				AD:        parquetInt(stats.AD),
+				ADTB:      parquetInt(stats.ADTB),
+				ADHG:      parquetInt(stats.ADHG),
+				ADTM:      parquetInt(stats.ADTM),
+				ADTS:      parquetInt(stats.ADTS),
+				SM:        parquetInt(stats.SM),
+			})
+		}
+	}
+
+	tables := []struct {
+		file   string
+		schema interface{}
+		rows   []interface{}
+	}{
+		{"fighters.parquet", new(parquetFighter), fighterRows},
+		{"fights.parquet", new(parquetFight), fightRows},
+		{"striking.parquet", new(parquetStriking), strikingRows},
+		{"clinch.parquet", new(parquetClinch), clinchRows},
+		{"ground.parquet", new(parquetGround), groundRows},
+	}
+	for _, table := range tables {
+		if err := writeParquetFile(filepath.Join(s.Dir, table.file), table.schema, table.rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parquetFighterRow splits the fighter's display strings into typed columns
+func parquetFighterRow(id string, fighter *FighterStats) *parquetFighter {
+	row := &parquetFighter{
+		FighterID: id,
+		FirstName: fighter.FirstName,
+		LastName:  fighter.LastName,
+		Nickname:  fighter.Nickname,
+		Team:      fighter.Team,
+		Stance:    fighter.Stance,
+		Birthdate: parquetDate(fighter.Birthdate),
+	}
+
+	inches, hasHeight, pounds, hasWeight := parseHeightAndWeight(fighter.HeightAndWeight)
+	if hasHeight {
+		row.HeightIn = int32Ptr(inches)
+	}
+	if hasWeight {
+		row.WeightLbs = &pounds
+	}
+
+	if record, ok := parseRecord(fighter.WinLossRecord); ok && len(record) >= 2 {
+		row.Wins, row.Losses = int32Ptr(record[0]), int32Ptr(record[1])
+		if len(record) >= 3 {
+			row.Draws = int32Ptr(record[2])
+		}
+	}
+	if record, ok := parseRecord(fighter.TKORecord); ok && len(record) >= 2 {
+		row.TKOWins, row.TKOLosses = int32Ptr(record[0]), int32Ptr(record[1])
+	}
+	if record, ok := parseRecord(fighter.SubRecord); ok && len(record) >= 2 {
+		row.SubWins, row.SubLosses = int32Ptr(record[0]), int32Ptr(record[1])
+	}
+	return row
+}
+
+// Helper function to write one Parquet file with Snappy compression
+func writeParquetFile(path string, schema interface{}, rows []interface{}) error {
+	file, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pw, err := writer.NewParquetWriter(file, schema, 4)
+	if err != nil {
+		return err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func int32Ptr(n int) *int32 {
+	v := int32(n)
+	return &v
+}
+
+func parquetInt(value string) *int32 {
+	if n, ok := parseStatInt(value); ok {
+		return int32Ptr(n)
+	}
+	return nil
+}
+
+func parquetFloat(value string) *float64 {
+	if f, ok := parseStatFloat(value); ok {
+		return &f
+	}
+	return nil
+}
+
+func parquetLandedAttempted(value string) (*int32, *int32) {
+	if landed, attempted, ok := parseLandedAttempted(value); ok {
+		return int32Ptr(landed), int32Ptr(attempted)
+	}
+	return nil, nil
+}
+
+// parquetDate returns the date as days since the Unix epoch, the DATE column encoding
+func parquetDate(value string) *int32 {
+	if t, ok := parseStatDate(value); ok {
+		return int32Ptr(int(t.Unix() / 86400))
+	}
+	return nil
+}
+
+func parquetFightTime(value string) *int32 {
+	if seconds, ok := parseFightTime(value); ok {
+		return int32Ptr(seconds)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// readParquetFile reads every row of a Parquet file, and the file's columns by their names in
+// the file
+func readParquetFile[T any](t *testing.T, path string) ([]T, map[string]*parquet.SchemaElement) {
+	t.Helper()
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	pr, err := reader.NewParquetReader(file, new(T), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	rows := make([]T, pr.GetNumRows())
+	if err := pr.Read(&rows); err != nil {
+		t.Fatal(err)
+	}
+	columns := make(map[string]*parquet.SchemaElement)
+	for i, element := range pr.SchemaHandler.SchemaElements {
+		columns[pr.SchemaHandler.GetExName(i)] = element
+	}
+	return rows, columns
+}
+
+func TestParquetSinkRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fighters := []FighterStats{
+		{
+			ID: "3022677", FirstName: "Conor", LastName: "McGregor", Nickname: "The Notorious",
+			HeightAndWeight: `5' 9", 155 lbs`, Birthdate: "7/14/1988 (36)", WinLossRecord: "22-6-0", TKORecord: "19-2",
+			Fights:        []Fight{{Date: "Jul 10, 2021", Opponent: "Dustin Poirier", Result: "L", Rnd: "1", Time: "5:00"}},
+			StrikingStats: []StrikingStats{{Date: "Jul 10, 2021", SDblA: "3/5", TSL: "16", TSA: "41", PercentLeg: "42%", KD: "-"}},
+			ClinchStats:   []ClinchStats{{Date: "Jul 10, 2021", SCBL: "2", TK_ACC: "0.5"}},
+			GroundStats:   []GroundStats{{Date: "Jul 10, 2021", SGHA: "1"}},
+		},
+		// Missing and unparsable values are nulls
+		{FirstName: "Test", LastName: "Fighter", HeightAndWeight: "-", Birthdate: "unknown", WinLossRecord: "-",
+			Fights: []Fight{{Date: "", Opponent: "Someone", Rnd: "-", Time: "--"}}},
+	}
+	if err := (&parquetSink{Dir: dir}).Write(fighters); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, columns := readParquetFile[parquetFighter](t, filepath.Join(dir, "fighters.parquet"))
+	if len(rows) != 2 {
+		t.Fatalf("%d fighter rows, want 2", len(rows))
+	}
+	conor := rows[0]
+	birthdate := time.Date(1988, 7, 14, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	if conor.FighterID != "3022677" || conor.Nickname != "The Notorious" {
+		t.Errorf("fighter %+v", conor)
+	}
+	if conor.Birthdate == nil || int64(*conor.Birthdate) != birthdate {
+		t.Errorf("birthdate %v, want day %d", conor.Birthdate, birthdate)
+	}
+	if conor.HeightIn == nil || *conor.HeightIn != 69 || conor.WeightLbs == nil || *conor.WeightLbs != 155 {
+		t.Errorf("height %v and weight %v, want 69 and 155", conor.HeightIn, conor.WeightLbs)
+	}
+	if conor.Wins == nil || *conor.Wins != 22 || *conor.Losses != 6 || *conor.Draws != 0 || *conor.TKOWins != 19 || *conor.TKOLosses != 2 {
+		t.Errorf("records %+v", conor)
+	}
+	if conor.SubWins != nil || conor.SubLosses != nil {
+		t.Errorf("submission record %v-%v, want nulls", conor.SubWins, conor.SubLosses)
+	}
+	other := rows[1]
+	if other.FighterID != "test fighter" || other.Birthdate != nil || other.HeightIn != nil || other.WeightLbs != nil || other.Wins != nil || other.Draws != nil {
+		t.Errorf("fighter without values %+v, want nulls", other)
+	}
+
+	// The columns have the types the sink declares
+	for _, column := range []struct {
+		name      string
+		kind      parquet.Type
+		converted *parquet.ConvertedType
+		optional  bool
+	}{
+		{"fighter_id", parquet.Type_BYTE_ARRAY, parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8), false},
+		{"birthdate", parquet.Type_INT32, parquet.ConvertedTypePtr(parquet.ConvertedType_DATE), true},
+		{"weight_lbs", parquet.Type_DOUBLE, nil, true},
+		{"wins", parquet.Type_INT32, nil, true},
+	} {
+		element, ok := columns[column.name]
+		if !ok {
+			t.Errorf("no column %s", column.name)
+			continue
+		}
+		if element.GetType() != column.kind || (element.ConvertedType == nil) != (column.converted == nil) ||
+			column.converted != nil && *element.ConvertedType != *column.converted ||
+			(element.GetRepetitionType() == parquet.FieldRepetitionType_OPTIONAL) != column.optional {
+			t.Errorf("column %s is %v %v %v", column.name, element.GetType(), element.ConvertedType, element.GetRepetitionType())
+		}
+	}
+
+	fights, _ := readParquetFile[parquetFight](t, filepath.Join(dir, "fights.parquet"))
+	if len(fights) != 2 {
+		t.Fatalf("%d fight rows, want 2", len(fights))
+	}
+	if fight := fights[0]; fight.FighterID != "3022677" || fight.Position != 0 || fight.Date == nil || fight.Rnd == nil || *fight.Rnd != 1 || fight.TimeSeconds == nil || *fight.TimeSeconds != 300 {
+		t.Errorf("fight %+v", fight)
+	}
+	if fight := fights[1]; fight.FighterID != "test fighter" || fight.Date != nil || fight.Rnd != nil || fight.TimeSeconds != nil {
+		t.Errorf("fight without values %+v, want nulls", fight)
+	}
+
+	striking, _ := readParquetFile[parquetStriking](t, filepath.Join(dir, "striking.parquet"))
+	if len(striking) != 1 {
+		t.Fatalf("%d striking rows, want 1", len(striking))
+	}
+	row := striking[0]
+	if row.SDBLLanded == nil || *row.SDBLLanded != 3 || *row.SDBLAttempted != 5 || row.SDHLLanded != nil {
+		t.Errorf("landed/attempted split %v/%v, head %v", row.SDBLLanded, row.SDBLAttempted, row.SDHLLanded)
+	}
+	if row.TSL == nil || *row.TSL != 16 || row.PercentLeg == nil || *row.PercentLeg != 42 || row.KD != nil || row.PercentBody != nil {
+		t.Errorf("striking row %+v", row)
+	}
+
+	clinch, _ := readParquetFile[parquetClinch](t, filepath.Join(dir, "clinch.parquet"))
+	if len(clinch) != 1 || clinch[0].SCBL == nil || *clinch[0].SCBL != 2 || clinch[0].TKAcc == nil || *clinch[0].TKAcc != 0.5 || clinch[0].SCBA != nil {
+		t.Errorf("clinch rows %+v", clinch)
+	}
+	ground, _ := readParquetFile[parquetGround](t, filepath.Join(dir, "ground.parquet"))
+	if len(ground) != 1 || ground[0].SGHA == nil || *ground[0].SGHA != 1 || ground[0].SGHL != nil {
+		t.Errorf("ground rows %+v", ground)
+	}
+}
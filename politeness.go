@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// politenessPolicy controls how gently the crawl treats the sites it visits
+type politenessPolicy struct {
+	RespectRobotsTxt   bool
+	MinDelay           time.Duration // Minimum delay between requests to the same domain
+	RandomDelay        time.Duration // Extra random delay added on top of MinDelay
+	Parallelism        int           // Concurrent requests allowed per domain
+	MaxRequestsPerHour int           // Zero means no budget
+}
+
+// politenessMetadata is the politeness policy as written to the run metadata and to the
+// output envelope
+type politenessMetadata struct {
+	RespectRobotsTxt   bool   `json:"respect_robots_txt" description:"Whether robots.txt was respected"`
+	MinDelay           string `json:"min_delay" description:"Minimum delay between requests to the same domain"`
+	RandomDelay        string `json:"random_delay" description:"Extra random delay added on top of min_delay"`
+	Parallelism        int    `json:"parallelism" description:"Concurrent requests allowed per domain"`
+	MaxRequestsPerHour int    `json:"max_requests_per_hour" description:"Requests allowed in any rolling hour, 0 for no limit"`
+}
+
+// runMetadata describes a crawl run and is written next to the scraped data
+type runMetadata struct {
+	RunID      string             `json:"run_id"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt time.Time          `json:"finished_at"`
+	Politeness politenessMetadata `json:"politeness"`
+}
+
+// loadPolitenessPolicy builds the policy from the environment. MMA_POLITE=true respects
+// robots.txt, sends one request per domain at a time and applies a default delay and
+// hourly budget; MMA_MIN_DELAY (a duration such as "10s"), MMA_RANDOM_DELAY, MMA_CONCURRENCY
+// and MMA_MAX_REQUESTS_PER_HOUR override those defaults in either mode.
+func loadPolitenessPolicy() (politenessPolicy, error) {
+	policy := politenessPolicy{
+		RandomDelay: 4 * time.Second,
+		Parallelism: 8,
+	}
+
+	if env := os.Getenv("MMA_POLITE"); env != "" {
+		polite, err := strconv.ParseBool(env)
+		if err != nil {
+			return policy, fmt.Errorf("invalid MMA_POLITE %q: %v", env, err)
+		}
+		if polite {
+			policy.RespectRobotsTxt = true
+			policy.MinDelay = 10 * time.Second
+			policy.Parallelism = 1
+			policy.MaxRequestsPerHour = 300
+		}
+	}
+
+	if env := os.Getenv("MMA_MIN_DELAY"); env != "" {
+		delay, err := time.ParseDuration(env)
+		if err != nil {
+			return policy, fmt.Errorf("invalid MMA_MIN_DELAY %q: %v", env, err)
+		}
+		policy.MinDelay = delay
+	}
+
+	if env := os.Getenv("MMA_RANDOM_DELAY"); env != "" {
+		delay, err := time.ParseDuration(env)
+		if err != nil {
+			return policy, fmt.Errorf("invalid MMA_RANDOM_DELAY %q: %v", env, err)
+		}
+		policy.RandomDelay = delay
+	}
+
+	if env := os.Getenv("MMA_CONCURRENCY"); env != "" {
+		parallelism, err := strconv.Atoi(env)
+		if err != nil || parallelism <= 0 {
+			return policy, fmt.Errorf("invalid MMA_CONCURRENCY %q", env)
+		}
+		policy.Parallelism = parallelism
+	}
+
+	if env := os.Getenv("MMA_MAX_REQUESTS_PER_HOUR"); env != "" {
+		budget, err := strconv.Atoi(env)
+		if err != nil || budget < 0 {
+			return policy, fmt.Errorf("invalid MMA_MAX_REQUESTS_PER_HOUR %q", env)
+		}
+		policy.MaxRequestsPerHour = budget
+	}
+
+	return policy, nil
+}
+
+func (p politenessPolicy) metadata() politenessMetadata {
+	return politenessMetadata{
+		RespectRobotsTxt:   p.RespectRobotsTxt,
+		MinDelay:           p.MinDelay.String(),
+		RandomDelay:        p.RandomDelay.String(),
+		Parallelism:        p.Parallelism,
+		MaxRequestsPerHour: p.MaxRequestsPerHour,
+	}
+}
+
+// hourlyBudget limits the number of requests started in any rolling hour
+type hourlyBudget struct {
+	max   int
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	mu      sync.Mutex
+	started []time.Time // Start times of the requests in the last hour, oldest first
+}
+
+func newHourlyBudget(max int) *hourlyBudget {
+	return &hourlyBudget{max: max, now: time.Now, sleep: time.Sleep}
+}
+
+// wait blocks until another request fits in the budget, then counts it
+func (b *hourlyBudget) wait() {
+	if b.max <= 0 {
+		return
+	}
+
+	for {
+		b.mu.Lock()
+		now := b.now()
+
+		// Forget requests that are an hour old or more
+		cutoff := now.Add(-time.Hour)
+		expired := 0
+		for expired < len(b.started) && !b.started[expired].After(cutoff) {
+			expired++
+		}
+		b.started = b.started[expired:]
+
+		if len(b.started) < b.max {
+			b.started = append(b.started, now)
+			b.mu.Unlock()
+			return
+		}
+
+		remaining := b.started[0].Add(time.Hour).Sub(now)
+		b.mu.Unlock()
+
+		log.Printf("Hourly request budget of %d used up, waiting %s\n", b.max, remaining.Round(time.Second))
+		b.sleep(remaining)
+	}
+}
+
+// Helper function to write the run metadata as JSON
+func writeRunMetadata(path string, metadata runMetadata) error {
+	jsonData, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, jsonData, 0644)
+}
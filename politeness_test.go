@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPolitenessPolicy(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want politenessPolicy
+	}{
+		{nil, politenessPolicy{RandomDelay: 4 * time.Second, Parallelism: 8}},
+		{map[string]string{"MMA_POLITE": "false"}, politenessPolicy{RandomDelay: 4 * time.Second, Parallelism: 8}},
+		{map[string]string{"MMA_POLITE": "true"}, politenessPolicy{RespectRobotsTxt: true, MinDelay: 10 * time.Second, RandomDelay: 4 * time.Second, Parallelism: 1, MaxRequestsPerHour: 300}},
+		// The other settings override the defaults of either mode
+		{
+			map[string]string{"MMA_POLITE": "true", "MMA_MIN_DELAY": "30s", "MMA_RANDOM_DELAY": "0s", "MMA_CONCURRENCY": "2", "MMA_MAX_REQUESTS_PER_HOUR": "0"},
+			politenessPolicy{RespectRobotsTxt: true, MinDelay: 30 * time.Second, Parallelism: 2},
+		},
+		{
+			map[string]string{"MMA_MIN_DELAY": "1s", "MMA_MAX_REQUESTS_PER_HOUR": "1000"},
+			politenessPolicy{MinDelay: time.Second, RandomDelay: 4 * time.Second, Parallelism: 8, MaxRequestsPerHour: 1000},
+		},
+	}
+	for _, test := range tests {
+		clearSettings(t)
+		for env, value := range test.env {
+			t.Setenv(env, value)
+		}
+		policy, err := loadPolitenessPolicy()
+		if err != nil || policy != test.want {
+			t.Errorf("%v: policy %+v, %v, want %+v", test.env, policy, err, test.want)
+		}
+	}
+
+	for env, value := range map[string]string{"MMA_POLITE": "yes please", "MMA_MIN_DELAY": "10", "MMA_CONCURRENCY": "0", "MMA_MAX_REQUESTS_PER_HOUR": "-1"} {
+		clearSettings(t)
+		t.Setenv(env, value)
+		if _, err := loadPolitenessPolicy(); err == nil || !strings.Contains(err.Error(), env) {
+			t.Errorf("%s=%s: error %v", env, value, err)
+		}
+	}
+}
+
+// newTestBudget is a budget on a clock that only moves when the budget sleeps, or when the
+// returned function advances it. It also returns the sleeps so far.
+func newTestBudget(max int) (*hourlyBudget, func(time.Duration), func() []time.Duration) {
+	budget := newHourlyBudget(max)
+	now := time.Date(2024, 7, 11, 3, 0, 0, 0, time.UTC)
+	var sleeps []time.Duration
+	budget.now = func() time.Time { return now }
+	budget.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+	advance := func(d time.Duration) { now = now.Add(d) }
+	return budget, advance, func() []time.Duration { return sleeps }
+}
+
+func TestHourlyBudgetRollingHour(t *testing.T) {
+	budget, advance, sleeps := newTestBudget(3)
+
+	// Requests at 0, 10 and 20 minutes fit
+	for i := 0; i < 3; i++ {
+		budget.wait()
+		advance(10 * time.Minute)
+	}
+	if got := sleeps(); len(got) != 0 {
+		t.Fatalf("slept %v within the budget", got)
+	}
+
+	// At 30 minutes the budget is used up until the first request is an hour old
+	budget.wait()
+	if got := sleeps(); len(got) != 1 || got[0] != 30*time.Minute {
+		t.Fatalf("slept %v, want 30m", got)
+	}
+
+	// At 60 minutes the next slot is when the request at 10 minutes expires
+	budget.wait()
+	if got := sleeps(); len(got) != 2 || got[1] != 10*time.Minute {
+		t.Fatalf("slept %v, want 30m then 10m", got)
+	}
+
+	// After a quiet hour the whole budget is free again
+	advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		budget.wait()
+	}
+	if got := sleeps(); len(got) != 2 {
+		t.Errorf("slept %v after a quiet hour", got[2:])
+	}
+}
+
+func TestHourlyBudgetUnlimited(t *testing.T) {
+	budget, _, sleeps := newTestBudget(0)
+	for i := 0; i < 1000; i++ {
+		budget.wait()
+	}
+	if len(sleeps()) != 0 || len(budget.started) != 0 {
+		t.Errorf("a budget of 0 slept %d times and counted %d requests", len(sleeps()), len(budget.started))
+	}
+}
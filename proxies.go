@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+const defaultProxyFile = "proxies.txt"
+
+// proxyHealth holds the running health numbers for a single proxy
+type proxyHealth struct {
+	URL          *url.URL
+	Requests     int
+	Errors       int // Network errors and 5xx responses
+	Bans         int // 403 and 429 responses
+	TotalLatency time.Duration
+
+	consecutiveFailures int
+	ejectedUntil        time.Time
+}
+
+// proxyPool rotates requests through the healthy proxies, ejecting proxies that keep
+// failing and re-admitting them once they have sat out for a while
+type proxyPool struct {
+	MaxFailures int           // Consecutive failures before a proxy is ejected
+	EjectFor    time.Duration // How long an ejected proxy sits out before it is tried again
+
+	mu      sync.Mutex
+	proxies []*proxyHealth
+	index   int
+}
+
+// loadProxyURLs reads the proxy list from the MMA_PROXIES environment variable (comma separated)
+// or, if that is not set, from the file named by MMA_PROXY_FILE (default proxies.txt), one proxy
+// per line. Setting MMA_PROXIES to "off" or leaving both unset runs without proxies.
+func loadProxyURLs() ([]string, error) {
+	if env, ok := os.LookupEnv("MMA_PROXIES"); ok {
+		if strings.EqualFold(strings.TrimSpace(env), "off") {
+			return nil, nil
+		}
+		var proxyURLs []string
+		for _, p := range strings.Split(env, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				proxyURLs = append(proxyURLs, p)
+			}
+		}
+		return proxyURLs, nil
+	}
+
+	path := os.Getenv("MMA_PROXY_FILE")
+	if path == "" {
+		path = defaultProxyFile
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) && path == defaultProxyFile {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var proxyURLs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Skip blank lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxyURLs = append(proxyURLs, line)
+	}
+	return proxyURLs, scanner.Err()
+}
+
+// loadProxyEjection reads when a failing proxy is left out of the rotation from the environment:
+// after MMA_PROXY_MAX_FAILURES failures in a row (default 3), for MMA_PROXY_EJECT_FOR (default 10m)
+func loadProxyEjection() (int, time.Duration, error) {
+	maxFailures, ejectFor := 3, 10*time.Minute
+
+	if env := os.Getenv("MMA_PROXY_MAX_FAILURES"); env != "" {
+		failures, err := strconv.Atoi(env)
+		if err != nil || failures <= 0 {
+			return 0, 0, fmt.Errorf("invalid MMA_PROXY_MAX_FAILURES %q", env)
+		}
+		maxFailures = failures
+	}
+	if env := os.Getenv("MMA_PROXY_EJECT_FOR"); env != "" {
+		delay, err := time.ParseDuration(env)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid MMA_PROXY_EJECT_FOR %q: %v", env, err)
+		}
+		ejectFor = delay
+	}
+	return maxFailures, ejectFor, nil
+}
+
+func newProxyPool(proxyURLs []string, maxFailures int, ejectFor time.Duration) (*proxyPool, error) {
+	pool := &proxyPool{
+		MaxFailures: maxFailures,
+		EjectFor:    ejectFor,
+	}
+	for _, p := range proxyURLs {
+		parsed, err := url.Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %v", p, err)
+		}
+		pool.proxies = append(pool.proxies, &proxyHealth{URL: parsed})
+	}
+	return pool, nil
+}
+
+// next picks the next healthy proxy in round-robin order. If every proxy is ejected,
+// the one closest to re-admission is used.
+func (p *proxyPool) next() *url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < len(p.proxies); i++ {
+		candidate := p.proxies[(p.index+i)%len(p.proxies)]
+		if !now.Before(candidate.ejectedUntil) {
+			p.index = (p.index + i + 1) % len(p.proxies)
+			return candidate.URL
+		}
+	}
+
+	var chosen *proxyHealth
+	for _, candidate := range p.proxies {
+		if chosen == nil || candidate.ejectedUntil.Before(chosen.ejectedUntil) {
+			chosen = candidate
+		}
+	}
+	return chosen.URL
+}
+
+// proxyFromContext is an http.Transport proxy func that uses the proxy picked for the request,
+// or connects directly if none was picked
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	if proxyURL, ok := req.Context().Value(colly.ProxyURLKey).(string); ok {
+		return url.Parse(proxyURL)
+	}
+	return nil, nil
+}
+
+// record updates the health of a proxy after a request went through it
+func (p *proxyPool) record(proxyURL string, statusCode int, err error, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var health *proxyHealth
+	for _, candidate := range p.proxies {
+		if candidate.URL.String() == proxyURL {
+			health = candidate
+			break
+		}
+	}
+	if health == nil {
+		return
+	}
+
+	health.Requests++
+	health.TotalLatency += latency
+
+	failed := true
+	switch {
+	case err != nil || statusCode >= 500:
+		health.Errors++
+	case statusCode == 403 || statusCode == 429:
+		health.Bans++
+	default:
+		failed = false
+	}
+
+	if !failed {
+		health.consecutiveFailures = 0
+		return
+	}
+	health.consecutiveFailures++
+	if health.consecutiveFailures >= p.MaxFailures {
+		health.consecutiveFailures = 0
+		health.ejectedUntil = time.Now().Add(p.EjectFor)
+		log.Printf("Ejecting proxy %s for %s\n", health.URL.Host, p.EjectFor)
+	}
+}
+
+// transport wraps base so that every request is sent through the next proxy in the pool,
+// and its outcome is recorded against that proxy
+func (p *proxyPool) transport(base http.RoundTripper) http.RoundTripper {
+	return &proxyTrackingTransport{pool: p, base: base}
+}
+
+// logSummary prints the health numbers of every proxy
+func (p *proxyPool) logSummary() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, health := range p.proxies {
+		var avgLatency time.Duration
+		if health.Requests > 0 {
+			avgLatency = health.TotalLatency / time.Duration(health.Requests)
+		}
+		log.Printf("Proxy %s: %d requests, %d errors, %d bans, %s average latency\n",
+			health.URL.Host, health.Requests, health.Errors, health.Bans, avgLatency.Round(time.Millisecond))
+	}
+}
+
+type proxyTrackingTransport struct {
+	pool *proxyPool
+	base http.RoundTripper
+}
+
+func (t *proxyTrackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxyURL := t.pool.next().String()
+	req = req.WithContext(context.WithValue(req.Context(), colly.ProxyURLKey, proxyURL))
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	t.pool.record(proxyURL, statusCode, err, time.Since(start))
+	return resp, err
+}
+
+// newScraperTransport gives each proxy a consistent browser identity with its own cookies, and
+// rotates through the configured proxies, or connects directly if there are none. The pool is
+// nil without proxies.
+func newScraperTransport() (http.RoundTripper, *proxyPool, error) {
+	profiles, err := loadBrowserProfiles()
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading browser profiles: %v", err)
+	}
+	sessions := newSessionManager(profiles)
+	var transport http.RoundTripper = sessions.transport(&http.Transport{Proxy: proxyFromContext})
+
+	proxyURLs, err := loadProxyURLs()
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading proxies: %v", err)
+	}
+	if len(proxyURLs) == 0 {
+		debugf("No proxies configured, connecting directly\n")
+		return transport, nil, nil
+	}
+	maxFailures, ejectFor, err := loadProxyEjection()
+	if err != nil {
+		return nil, nil, err
+	}
+	proxies, err := newProxyPool(proxyURLs, maxFailures, ejectFor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("setting up proxy pool: %v", err)
+	}
+	log.Printf("Using %d proxies\n", len(proxyURLs))
+	return proxies.transport(transport), proxies, nil
+}
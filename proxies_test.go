@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProxyPool(t *testing.T, maxFailures int, ejectFor time.Duration) *proxyPool {
+	t.Helper()
+	pool, err := newProxyPool([]string{"http://proxy1.example.com:8080", "http://proxy2.example.com:8080", "http://proxy3.example.com:8080"}, maxFailures, ejectFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// nextHosts returns the hosts of the next n proxies the pool picks
+func nextHosts(pool *proxyPool, n int) []string {
+	var hosts []string
+	for i := 0; i < n; i++ {
+		hosts = append(hosts, strings.TrimSuffix(pool.next().Host, ".example.com:8080"))
+	}
+	return hosts
+}
+
+func TestProxyPoolEjectsAfterMaxFailures(t *testing.T) {
+	pool := newTestProxyPool(t, 3, time.Hour)
+	if got := strings.Join(nextHosts(pool, 4), " "); got != "proxy1 proxy2 proxy3 proxy1" {
+		t.Errorf("rotation %s, want round robin", got)
+	}
+
+	// Failures have to be in a row: a success starts the count again
+	const proxy2 = "http://proxy2.example.com:8080"
+	pool.record(proxy2, 503, nil, time.Millisecond)
+	pool.record(proxy2, 0, errors.New("connection refused"), time.Millisecond)
+	pool.record(proxy2, 200, nil, time.Millisecond)
+	pool.record(proxy2, 429, nil, time.Millisecond)
+	pool.record(proxy2, 403, nil, time.Millisecond)
+	if got := strings.Join(nextHosts(pool, 3), " "); got != "proxy2 proxy3 proxy1" {
+		t.Errorf("rotation %s, want proxy2 still in it", got)
+	}
+
+	// A 404 is the page's fault, not the proxy's
+	pool.record(proxy2, 404, nil, time.Millisecond)
+	pool.record(proxy2, 500, nil, time.Millisecond)
+	pool.record(proxy2, 500, nil, time.Millisecond)
+	pool.record(proxy2, 500, nil, time.Millisecond)
+	if got := strings.Join(nextHosts(pool, 4), " "); got != "proxy3 proxy1 proxy3 proxy1" {
+		t.Errorf("rotation %s, want proxy2 left out", got)
+	}
+
+	health := pool.proxies[1]
+	if health.Requests != 9 || health.Errors != 5 || health.Bans != 2 || health.TotalLatency != 9*time.Millisecond {
+		t.Errorf("proxy2 health %+v", health)
+	}
+	// Records for a proxy that isn't in the pool are ignored
+	pool.record("http://other.example.com:8080", 500, nil, time.Millisecond)
+}
+
+func TestProxyPoolReadmitsAfterEjectFor(t *testing.T) {
+	pool := newTestProxyPool(t, 1, 50*time.Millisecond)
+	pool.record("http://proxy1.example.com:8080", 503, nil, 0)
+	if got := strings.Join(nextHosts(pool, 2), " "); got != "proxy2 proxy3" {
+		t.Errorf("rotation %s, want proxy1 left out", got)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := strings.Join(nextHosts(pool, 3), " "); got != "proxy1 proxy2 proxy3" {
+		t.Errorf("rotation %s, want proxy1 back in it", got)
+	}
+}
+
+// With every proxy ejected, the one closest to being readmitted is used rather than none
+func TestProxyPoolAllEjected(t *testing.T) {
+	pool := newTestProxyPool(t, 1, 3*time.Hour)
+	pool.record("http://proxy1.example.com:8080", 503, nil, 0)
+	pool.EjectFor = time.Hour
+	pool.record("http://proxy2.example.com:8080", 503, nil, 0)
+	pool.EjectFor = 2 * time.Hour
+	pool.record("http://proxy3.example.com:8080", 503, nil, 0)
+
+	if got := strings.Join(nextHosts(pool, 2), " "); got != "proxy2 proxy2" {
+		t.Errorf("picked %s, want proxy2, readmitted first", got)
+	}
+}
+
+func TestLoadProxyEjection(t *testing.T) {
+	clearSettings(t)
+	maxFailures, ejectFor, err := loadProxyEjection()
+	if err != nil || maxFailures != 3 || ejectFor != 10*time.Minute {
+		t.Errorf("defaults %d, %s, %v, want 3 and 10m", maxFailures, ejectFor, err)
+	}
+
+	t.Setenv("MMA_PROXY_MAX_FAILURES", "5")
+	t.Setenv("MMA_PROXY_EJECT_FOR", "30s")
+	maxFailures, ejectFor, err = loadProxyEjection()
+	if err != nil || maxFailures != 5 || ejectFor != 30*time.Second {
+		t.Errorf("%d, %s, %v, want 5 and 30s", maxFailures, ejectFor, err)
+	}
+
+	t.Setenv("MMA_PROXY_MAX_FAILURES", "0")
+	if _, _, err := loadProxyEjection(); err == nil || !strings.Contains(err.Error(), "MMA_PROXY_MAX_FAILURES") {
+		t.Errorf("MMA_PROXY_MAX_FAILURES=0: error %v", err)
+	}
+}
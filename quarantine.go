@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultQuarantineDir = "quarantine"
+
+// emptyTablesDir is the subdirectory of the quarantine directory for pages that parsed but had
+// an empty table
+const emptyTablesDir = "empty-tables"
+
+// errNoFighterName is returned for a fighter page without a name in its header or URL, which
+// would otherwise be dropped without a trace
+var errNoFighterName = errors.New("no fighter name in the page header or URL")
+
+// quarantinedPage describes a page saved to the quarantine directory, next to its HTML
+type quarantinedPage struct {
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetched_at"`
+	RunID     string    `json:"run_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Issues    []string  `json:"issues,omitempty"` // The empty tables of a page that did parse
+}
+
+// pageQuarantine saves the raw HTML of pages that failed to parse, including pages without a
+// fighter name, so they can be turned into regression fixtures. Pages that parsed with an
+// empty table are saved apart, in the empty-tables subdirectory, since such tables are often
+// just empty.
+type pageQuarantine struct {
+	Dir   string
+	RunID string
+
+	mu          sync.Mutex
+	count       int
+	emptyTables int
+}
+
+// newPageQuarantine saves pages to MMA_QUARANTINE_DIR (default quarantine), or nowhere when it
+// is "off"
+func newPageQuarantine(runID string) *pageQuarantine {
+	dir := os.Getenv("MMA_QUARANTINE_DIR")
+	if dir == "" {
+		dir = defaultQuarantineDir
+	}
+	if dir == "off" {
+		dir = ""
+	}
+	return &pageQuarantine{Dir: dir, RunID: runID}
+}
+
+// reportParseFailure logs a page that failed to parse, with the context needed to find it
+// again, and quarantines it. The failure is returned as a quality issue for the run's report.
+func (q *pageQuarantine) reportParseFailure(pageURL *url.URL, body []byte, err error) qualityIssue {
+	path := q.save(q.Dir, pageURL, body, quarantinedPage{Error: err.Error()})
+	if path != "" {
+		q.mu.Lock()
+		q.count++
+		q.mu.Unlock()
+	}
+	slog.Warn("Fighter page failed to parse",
+		"url", pageURL.String(),
+		"page", pageKind(pageURL),
+		"fighter_id", fighterIDFromURL(pageURL.Path),
+		"bytes", len(body),
+		"error", err,
+		"quarantine", path,
+	)
+	return qualityIssue{
+		FighterID: fighterIDFromURL(pageURL.Path),
+		Rule:      ruleParse,
+		Message:   err.Error(),
+		SourceURL: pageURL.String(),
+	}
+}
+
+// saveEmptyTables keeps a page whose empty-table issues are given, so the markup behind them
+// can be looked at
+func (q *pageQuarantine) saveEmptyTables(pageURL *url.URL, body []byte, issues []qualityIssue) {
+	if q == nil || q.Dir == "" || len(issues) == 0 {
+		return
+	}
+	var messages []string
+	for _, issue := range issues {
+		messages = append(messages, issue.Message)
+	}
+	if q.save(filepath.Join(q.Dir, emptyTablesDir), pageURL, body, quarantinedPage{Issues: messages}) != "" {
+		q.mu.Lock()
+		q.emptyTables++
+		q.mu.Unlock()
+	}
+}
+
+// save writes a page's HTML and what went wrong with it into dir, named after its URL, and
+// returns the HTML's path. A later save of the same page replaces the files.
+func (q *pageQuarantine) save(dir string, pageURL *url.URL, body []byte, page quarantinedPage) string {
+	if q == nil || q.Dir == "" {
+		return ""
+	}
+	page.URL = pageURL.String()
+	page.FetchedAt = time.Now().UTC()
+	page.RunID = q.RunID
+
+	name := slugify(pageURL.Host + " " + strings.ReplaceAll(pageURL.Path, "_", " "))
+	path := filepath.Join(dir, name+".html")
+	jsonData, err := json.MarshalIndent(page, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, body, 0644)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".json"), jsonData, 0644)
+	}
+	if err != nil {
+		slog.Error("Error quarantining page", "url", page.URL, "error", err)
+		return ""
+	}
+	return path
+}
+
+// saved is the number of pages that failed to parse quarantined so far
+func (q *pageQuarantine) saved() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// savedEmptyTables is the number of pages with empty tables saved so far
+func (q *pageQuarantine) savedEmptyTables() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.emptyTables
+}
+
+// pageKind names the kind of fighter page a URL is, for logs
+func pageKind(pageURL *url.URL) string {
+	switch {
+	case strings.Contains(pageURL.String(), "stats"):
+		return "stats"
+	case strings.Contains(pageURL.String(), "history"):
+		return "history"
+	}
+	return "other"
+}
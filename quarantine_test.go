@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuarantinePageWithoutName(t *testing.T) {
+	pageURL, _ := url.Parse("https://www.espn.com/mma/fighter/stats/_/id/3022677")
+	body := []byte("<html><body></body></html>")
+	_, _, _, _, err := parseFighterPage(pageURL, body)
+	if !errors.Is(err, errNoFighterName) {
+		t.Fatalf("parseFighterPage of a page without a name = %v, want %v", err, errNoFighterName)
+	}
+
+	quarantine := &pageQuarantine{Dir: t.TempDir(), RunID: "test-run"}
+	issue := quarantine.reportParseFailure(pageURL, body, err)
+	if issue.Rule != ruleParse || issue.FighterID != "3022677" || issue.SourceURL != pageURL.String() {
+		t.Errorf("issue %+v", issue)
+	}
+	if quarantine.saved() != 1 {
+		t.Errorf("%d pages saved, want 1", quarantine.saved())
+	}
+
+	name := filepath.Join(quarantine.Dir, "www-espn-com-mma-fighter-stats-id-3022677")
+	if saved, err := os.ReadFile(name + ".html"); err != nil || string(saved) != string(body) {
+		t.Errorf("saved HTML %q, %v", saved, err)
+	}
+	data, err := os.ReadFile(name + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page quarantinedPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.URL != pageURL.String() || page.RunID != "test-run" || page.Error != errNoFighterName.Error() {
+		t.Errorf("saved page %+v", page)
+	}
+}
+
+func TestQuarantineOff(t *testing.T) {
+	t.Setenv("MMA_QUARANTINE_DIR", "off")
+	quarantine := newPageQuarantine("test-run")
+	pageURL, _ := url.Parse("https://www.espn.com/mma/fighter/stats/_/id/3022677")
+	quarantine.reportParseFailure(pageURL, nil, errNoFighterName)
+	quarantine.saveEmptyTables(pageURL, nil, []qualityIssue{{Rule: ruleEmptyTable}})
+	if quarantine.saved() != 0 || quarantine.savedEmptyTables() != 0 {
+		t.Errorf("%d pages saved with the quarantine off", quarantine.saved())
+	}
+}
+
+func TestQuarantinePageWithEmptyTables(t *testing.T) {
+	pageURL, _ := url.Parse("https://www.espn.com/mma/fighter/stats/_/id/3022677/conor-mcgregor")
+	body := []byte(`<html><body><div class="PlayerHeader__Main"><span>Conor</span><span>McGregor</span></div>` +
+		`<div class="Table__Title">striking</div></body></html>`)
+	_, _, _, issues, err := parseFighterPage(pageURL, body)
+	if err != nil || len(issues) != 1 || issues[0].Rule != ruleEmptyTable {
+		t.Fatalf("parseFighterPage = issues %+v, %v, want an empty striking table", issues, err)
+	}
+
+	quarantine := &pageQuarantine{Dir: t.TempDir(), RunID: "test-run"}
+	quarantine.saveEmptyTables(pageURL, body, issues)
+	quarantine.saveEmptyTables(pageURL, body, nil)
+	if quarantine.saved() != 0 || quarantine.savedEmptyTables() != 1 {
+		t.Errorf("%d pages that failed to parse and %d with empty tables saved, want 0 and 1", quarantine.saved(), quarantine.savedEmptyTables())
+	}
+
+	// The page is kept apart from the pages that failed to parse
+	name := filepath.Join(quarantine.Dir, emptyTablesDir, "www-espn-com-mma-fighter-stats-id-3022677-conor-mcgregor")
+	if saved, err := os.ReadFile(name + ".html"); err != nil || string(saved) != string(body) {
+		t.Errorf("saved HTML %q, %v", saved, err)
+	}
+	data, err := os.ReadFile(name + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page quarantinedPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.URL != pageURL.String() || page.RunID != "test-run" || page.Error != "" || len(page.Issues) != 1 || page.Issues[0] != issues[0].Message {
+		t.Errorf("saved page %+v", page)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// queryIndex arranges a snapshot for the query API. Fighters only record their own side of a
+// fight, so bouts and events are rebuilt by pairing each fight with the opponent's record of
+// it.
+type queryIndex struct {
+	Source   string
+	RunID    string
+	LoadedAt time.Time
+
+	fighters   []*FighterStats // Sorted by name
+	byID       map[string]*FighterStats
+	byName     map[string][]*FighterStats // Keyed by nameKey
+	events     []*queryEvent              // Most recent first
+	eventsByID map[string]*queryEvent
+	boutsByID  map[string]*queryBout
+	bouts      map[string][]*queryBout // Bouts of each fighter ID, most recent first
+	search     *searchIndex
+}
+
+// queryEvent is an event card, identified by its date and name, e.g. 2021-07-10-ufc-264
+type queryEvent struct {
+	ID    string       `json:"id"`
+	Name  string       `json:"name"`
+	Date  string       `json:"date"` // YYYY-MM-DD, empty when the date couldn't be read
+	Bouts []*queryBout `json:"bouts"`
+}
+
+// queryBout is one fight between two fighters, with each fighter's result and stats
+type queryBout struct {
+	ID       string        `json:"id"`
+	EventID  string        `json:"event_id"`
+	Event    string        `json:"event"`
+	Date     string        `json:"date"`
+	Decision string        `json:"decision"`
+	Round    string        `json:"round"`
+	Time     string        `json:"time"`
+	Corners  [2]boutCorner `json:"fighters"`
+}
+
+// boutCorner is one fighter's side of a bout. ID is empty for opponents that weren't scraped,
+// whose result is inferred from the other side.
+type boutCorner struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Result   string         `json:"result"`
+	Striking *StrikingStats `json:"striking_stats,omitempty"`
+	Clinch   *ClinchStats   `json:"clinch_stats,omitempty"`
+	Ground   *GroundStats   `json:"ground_stats,omitempty"`
+	scraped  bool
+}
+
+// fighterSummary is the short form of a fighter used in lists
+type fighterSummary struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Nickname string `json:"nickname"`
+	Division string `json:"division"`
+	Stance   string `json:"stance"`
+	Team     string `json:"team"`
+	Record   string `json:"record"`
+
+	Score float64 `json:"score,omitempty"` // How well the fighter matched a search
+}
+
+// UFC weight class limits in pounds, lightest first
+var divisions = []struct {
+	Name  string
+	Limit float64
+}{
+	{"Strawweight", 115},
+	{"Flyweight", 125},
+	{"Bantamweight", 135},
+	{"Featherweight", 145},
+	{"Lightweight", 155},
+	{"Welterweight", 170},
+	{"Middleweight", 185},
+	{"Light Heavyweight", 205},
+	{"Heavyweight", 265},
+}
+
+func newQueryIndex(source string, snapshot *outputEnvelope) *queryIndex {
+	index := &queryIndex{
+		Source:     source,
+		RunID:      snapshot.RunID,
+		LoadedAt:   time.Now().UTC(),
+		byID:       make(map[string]*FighterStats),
+		byName:     make(map[string][]*FighterStats),
+		eventsByID: make(map[string]*queryEvent),
+		boutsByID:  make(map[string]*queryBout),
+		bouts:      make(map[string][]*queryBout),
+	}
+	for i := range snapshot.Fighters {
+		fighter := &snapshot.Fighters[i]
+		index.fighters = append(index.fighters, fighter)
+		index.byID[fighterID(fighter)] = fighter
+		name := nameKey(fighterName(fighter))
+		index.byName[name] = append(index.byName[name], fighter)
+	}
+	sort.SliceStable(index.fighters, func(i, j int) bool {
+		return fighterName(index.fighters[i]) < fighterName(index.fighters[j])
+	})
+
+	index.search = newSearchIndex(index.fighters)
+	if aliases, err := loadAliasTable(); err != nil {
+		log.Printf("Error loading aliases: %v", err)
+	} else {
+		aliases.addTo(index)
+	}
+
+	for _, fighter := range index.fighters {
+		for i := range fighter.Fights {
+			index.addFight(fighter, &fighter.Fights[i])
+		}
+	}
+
+	for _, event := range index.eventsByID {
+		sort.Slice(event.Bouts, func(i, j int) bool { return event.Bouts[i].ID < event.Bouts[j].ID })
+		index.events = append(index.events, event)
+	}
+	sort.Slice(index.events, func(i, j int) bool {
+		if index.events[i].Date != index.events[j].Date {
+			return index.events[i].Date > index.events[j].Date
+		}
+		return index.events[i].ID < index.events[j].ID
+	})
+	for id, bouts := range index.bouts {
+		sort.SliceStable(bouts, func(i, j int) bool { return bouts[i].Date > bouts[j].Date })
+		index.bouts[id] = bouts
+	}
+	return index
+}
+
+// addFight adds a fighter's side of a fight to its bout, creating the bout and event the first
+// time either fighter's record of it is seen
+func (x *queryIndex) addFight(fighter *FighterStats, fight *Fight) {
+	name := fighterName(fighter)
+	date, eventID, boutID := boutIDs(name, fight)
+	names := []string{nameSlug(name), nameSlug(fight.Opponent)}
+	sort.Strings(names)
+
+	bout, ok := x.boutsByID[boutID]
+	if !ok {
+		bout = &queryBout{ID: boutID, EventID: eventID, Event: fight.Event, Date: date}
+		bout.Corners[0].Name, bout.Corners[1].Name = name, fight.Opponent
+		if nameSlug(name) != names[0] {
+			bout.Corners[0], bout.Corners[1] = bout.Corners[1], bout.Corners[0]
+		}
+		x.boutsByID[boutID] = bout
+
+		event, ok := x.eventsByID[eventID]
+		if !ok {
+			event = &queryEvent{ID: eventID, Name: fight.Event, Date: date}
+			x.eventsByID[eventID] = event
+		}
+		event.Bouts = append(event.Bouts, bout)
+	}
+	if bout.Decision == "" {
+		bout.Decision, bout.Round, bout.Time = fight.Decision, fight.Rnd, fight.Time
+	}
+
+	corner, other := &bout.Corners[0], &bout.Corners[1]
+	if nameSlug(name) != names[0] {
+		corner, other = other, corner
+	}
+	if !corner.scraped {
+		x.bouts[fighterID(fighter)] = append(x.bouts[fighterID(fighter)], bout)
+	}
+	corner.ID = fighterID(fighter)
+	corner.Name = name
+	corner.Result = fight.Result
+	corner.scraped = true
+	key := fightKey(fight.Date, fight.Opponent)
+	for i := range fighter.StrikingStats {
+		if fightKey(fighter.StrikingStats[i].Date, fighter.StrikingStats[i].Opponent) == key {
+			corner.Striking = &fighter.StrikingStats[i]
+		}
+	}
+	for i := range fighter.ClinchStats {
+		if fightKey(fighter.ClinchStats[i].Date, fighter.ClinchStats[i].Opponent) == key {
+			corner.Clinch = &fighter.ClinchStats[i]
+		}
+	}
+	for i := range fighter.GroundStats {
+		if fightKey(fighter.GroundStats[i].Date, fighter.GroundStats[i].Opponent) == key {
+			corner.Ground = &fighter.GroundStats[i]
+		}
+	}
+	if !other.scraped {
+		other.Result = oppositeResult(fight.Result)
+		if opponent := x.fighterByName(fight.Opponent); opponent != nil {
+			other.ID = fighterID(opponent)
+		}
+	}
+}
+
+// boutIDs returns the date of a fight as YYYY-MM-DD, and the IDs of its event and bout. The
+// bout ID is the same from either fighter's side.
+func boutIDs(name string, fight *Fight) (string, string, string) {
+	date := ""
+	if t, ok := parseStatDate(fight.Date); ok {
+		date = t.Format("2006-01-02")
+	}
+	eventID := slugify(date + " " + fight.Event)
+	names := []string{nameSlug(name), nameSlug(fight.Opponent)}
+	sort.Strings(names)
+	return date, eventID, eventID + "--" + names[0] + "--" + names[1]
+}
+
+// nameSlug is a fighter's name key joined with hyphens, for bout IDs. Built from nameKey, it
+// is the same for "José Aldo" on one record and "Jose Aldo" on the opponent's.
+func nameSlug(name string) string {
+	return strings.ReplaceAll(nameKey(name), " ", "-")
+}
+
+// fighterByName finds a fighter by name, if exactly one has it
+func (x *queryIndex) fighterByName(name string) *FighterStats {
+	if matches := x.byName[nameKey(name)]; len(matches) == 1 {
+		return matches[0]
+	}
+	return nil
+}
+
+// fighterFilter selects fighters for the list endpoint. Empty fields match everyone.
+type fighterFilter struct {
+	Query    string // Name, nickname or alias, matched with searchIndex
+	Division string
+	Stance   string
+	Team     string
+}
+
+// findFighters returns the fighters that pass the filter, sorted by name, or best match first
+// when there is a query. The scores of a query's matches are returned too.
+func (x *queryIndex) findFighters(filter fighterFilter) ([]*FighterStats, map[*FighterStats]float64) {
+	candidates := x.fighters
+	var scores map[*FighterStats]float64
+	if filter.Query != "" {
+		results := x.search.search(filter.Query, 0)
+		candidates = make([]*FighterStats, len(results))
+		scores = make(map[*FighterStats]float64, len(results))
+		for i, result := range results {
+			candidates[i] = result.Fighter
+			scores[result.Fighter] = result.Score
+		}
+	}
+
+	var found []*FighterStats
+	for _, fighter := range candidates {
+		if filter.Division != "" && slugify(fighterDivision(fighter)) != slugify(filter.Division) {
+			continue
+		}
+		if filter.Stance != "" && !strings.EqualFold(fighter.Stance, filter.Stance) {
+			continue
+		}
+		if filter.Team != "" && !strings.EqualFold(fighter.Team, filter.Team) {
+			continue
+		}
+		found = append(found, fighter)
+	}
+	return found, scores
+}
+
+// headToHead returns the bouts between two fighters, most recent first
+func (x *queryIndex) headToHead(a, b string) []*queryBout {
+	var bouts []*queryBout
+	for _, bout := range x.bouts[a] {
+		if bout.Corners[0].ID == b || bout.Corners[1].ID == b {
+			bouts = append(bouts, bout)
+		}
+	}
+	return bouts
+}
+
+func summarizeFighter(fighter *FighterStats) fighterSummary {
+	return fighterSummary{
+		ID:       fighterID(fighter),
+		Name:     fighterName(fighter),
+		Nickname: fighter.Nickname,
+		Division: fighterDivision(fighter),
+		Stance:   fighter.Stance,
+		Team:     fighter.Team,
+		Record:   fighter.WinLossRecord,
+	}
+}
+
+func fighterName(fighter *FighterStats) string {
+	return strings.TrimSpace(fighter.FirstName + " " + fighter.LastName)
+}
+
+// fighterDivision is the fighter's weight class by listed weight: the lightest UFC weight
+// limit their listed weight fits, or "" when ESPN doesn't list a weight. It is derived, not
+// scraped, so it can't tell women's from men's divisions, places a fighter who moved divisions
+// by their current weight, and is "" for weights above the heavyweight limit.
+func fighterDivision(fighter *FighterStats) string {
+	_, _, weight, ok := parseHeightAndWeight(fighter.HeightAndWeight)
+	if !ok {
+		return ""
+	}
+	for _, division := range divisions {
+		if weight <= division.Limit {
+			return division.Name
+		}
+	}
+	return ""
+}
+
+func oppositeResult(result string) string {
+	switch strings.ToUpper(result) {
+	case "W":
+		return "L"
+	case "L":
+		return "W"
+	}
+	return result
+}
+
+// slugify lowercases a string and joins its words with hyphens, for IDs in URLs
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// failedURL records a URL that could not be scraped, for the end-of-run report
+type failedURL struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error"`
+}
+
+// retryPolicy tracks attempts per URL and decides how long to back off before retrying
+type retryPolicy struct {
+	MaxAttempts int           // Attempts per URL before giving up, including the first
+	BaseDelay   time.Duration // Delay before the first retry, doubled on every attempt
+	MaxDelay    time.Duration // Upper bound on the computed backoff
+
+	mu       sync.Mutex
+	attempts map[string]int
+	failed   map[string]failedURL
+}
+
+func newRetryPolicy(maxAttempts int, baseDelay, maxDelay time.Duration) *retryPolicy {
+	return &retryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxDelay,
+		attempts:    make(map[string]int),
+		failed:      make(map[string]failedURL),
+	}
+}
+
+// loadRetryPolicy builds the retry policy from the environment: MMA_RETRY_ATTEMPTS (default 5),
+// MMA_RETRY_BASE_DELAY (default 30s) and MMA_RETRY_MAX_DELAY (default 10m)
+func loadRetryPolicy() (*retryPolicy, error) {
+	maxAttempts, baseDelay, maxDelay := 5, 30*time.Second, 10*time.Minute
+
+	if env := os.Getenv("MMA_RETRY_ATTEMPTS"); env != "" {
+		attempts, err := strconv.Atoi(env)
+		if err != nil || attempts <= 0 {
+			return nil, fmt.Errorf("invalid MMA_RETRY_ATTEMPTS %q", env)
+		}
+		maxAttempts = attempts
+	}
+	for _, setting := range []struct {
+		env   string
+		delay *time.Duration
+	}{{"MMA_RETRY_BASE_DELAY", &baseDelay}, {"MMA_RETRY_MAX_DELAY", &maxDelay}} {
+		if env := os.Getenv(setting.env); env != "" {
+			delay, err := time.ParseDuration(env)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %v", setting.env, env, err)
+			}
+			*setting.delay = delay
+		}
+	}
+	return newRetryPolicy(maxAttempts, baseDelay, maxDelay), nil
+}
+
+// nextDelay records a failed attempt for the response's URL and returns how long to wait
+// before retrying it. It returns false once the URL has used up its attempts, in which case
+// the URL is added to the failed report.
+func (p *retryPolicy) nextDelay(r *colly.Response, err error) (time.Duration, bool) {
+	url := r.Request.URL.String()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.attempts[url]++
+	attempt := p.attempts[url]
+	if attempt >= p.MaxAttempts {
+		p.failed[url] = newFailedURL(r, err, attempt)
+		return 0, false
+	}
+
+	delay := backoffDelay(attempt, p.BaseDelay, p.MaxDelay)
+	if retryAfter, ok := parseRetryAfter(r.Headers, time.Now()); ok && retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay, true
+}
+
+// giveUp adds a URL to the failed report without retrying it
+func (p *retryPolicy) giveUp(r *colly.Response, err error) {
+	url := r.Request.URL.String()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.attempts[url]++
+	p.failed[url] = newFailedURL(r, err, p.attempts[url])
+}
+
+// failedURLs returns every URL that was given up on, sorted by URL
+func (p *retryPolicy) failedURLs() []failedURL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	failed := make([]failedURL, 0, len(p.failed))
+	for _, f := range p.failed {
+		failed = append(failed, f)
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].URL < failed[j].URL
+	})
+	return failed
+}
+
+func newFailedURL(r *colly.Response, err error, attempts int) failedURL {
+	f := failedURL{
+		URL:        r.Request.URL.String(),
+		StatusCode: r.StatusCode,
+		Attempts:   attempts,
+	}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	return f
+}
+
+// backoffDelay returns an exponential delay for the given attempt with jitter applied,
+// so that workers banned at the same moment don't all come back at the same moment
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// Keep half of the delay and randomize the other half
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// parseRetryAfter reads the Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(headers *http.Header, now time.Time) (time.Duration, bool) {
+	if headers == nil {
+		return 0, false
+	}
+	value := headers.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// circuitBreaker pauses all requests when too many of the recent responses were bans
+type circuitBreaker struct {
+	Threshold  float64       // Ban rate that opens the breaker, between 0 and 1
+	MinSamples int           // Responses needed in the window before the rate is trusted
+	Cooldown   time.Duration // How long requests are paused once the breaker opens
+
+	mu        sync.Mutex
+	outcomes  []bool // Ring buffer of recent responses, true for a ban
+	next      int
+	count     int
+	openUntil time.Time
+}
+
+// loadCircuitBreaker builds the ban circuit breaker from the environment: MMA_BREAKER_THRESHOLD
+// (default 0.5), MMA_BREAKER_WINDOW (default 20) and MMA_BREAKER_COOLDOWN (default 5m)
+func loadCircuitBreaker() (*circuitBreaker, error) {
+	threshold, window, cooldown := 0.5, 20, 5*time.Minute
+
+	if env := os.Getenv("MMA_BREAKER_THRESHOLD"); env != "" {
+		rate, err := strconv.ParseFloat(env, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid MMA_BREAKER_THRESHOLD %q", env)
+		}
+		threshold = rate
+	}
+	if env := os.Getenv("MMA_BREAKER_WINDOW"); env != "" {
+		responses, err := strconv.Atoi(env)
+		if err != nil || responses <= 0 {
+			return nil, fmt.Errorf("invalid MMA_BREAKER_WINDOW %q", env)
+		}
+		window = responses
+	}
+	if env := os.Getenv("MMA_BREAKER_COOLDOWN"); env != "" {
+		delay, err := time.ParseDuration(env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MMA_BREAKER_COOLDOWN %q: %v", env, err)
+		}
+		cooldown = delay
+	}
+	return newCircuitBreaker(threshold, window, cooldown), nil
+}
+
+func newCircuitBreaker(threshold float64, window int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		Threshold:  threshold,
+		MinSamples: window,
+		Cooldown:   cooldown,
+		outcomes:   make([]bool, window),
+	}
+}
+
+// record adds a response outcome and opens the breaker if the ban rate crossed the threshold
+func (b *circuitBreaker) record(banned bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.outcomes[b.next] = banned
+	b.next = (b.next + 1) % len(b.outcomes)
+	if b.count < len(b.outcomes) {
+		b.count++
+	}
+	if b.count < b.MinSamples || time.Now().Before(b.openUntil) {
+		return
+	}
+
+	bans := 0
+	for i := 0; i < b.count; i++ {
+		if b.outcomes[i] {
+			bans++
+		}
+	}
+	if float64(bans)/float64(b.count) >= b.Threshold {
+		b.openUntil = time.Now().Add(b.Cooldown)
+		log.Printf("Ban rate %d/%d crossed threshold, pausing all requests for %s\n", bans, b.count, b.Cooldown)
+
+		// Start counting afresh once the pause is over
+		b.count = 0
+		b.next = 0
+	}
+}
+
+// wait blocks until the breaker is closed
+func (b *circuitBreaker) wait() {
+	for {
+		b.mu.Lock()
+		remaining := time.Until(b.openUntil)
+		b.mu.Unlock()
+
+		if remaining <= 0 {
+			return
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// Helper function to write the failed URL report as JSON
+func writeFailedURLReport(path string, failed []failedURL) error {
+	jsonData, err := json.MarshalIndent(failed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, jsonData, 0644)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		attempt        int
+		base, max      time.Duration
+		atLeast, below time.Duration
+	}{
+		// Half of the delay is kept and the other half is random
+		{1, time.Second, time.Minute, 500 * time.Millisecond, time.Second},
+		{2, time.Second, time.Minute, time.Second, 2 * time.Second},
+		{4, time.Second, time.Minute, 4 * time.Second, 8 * time.Second},
+		// The doubled delay stops at the ceiling
+		{6, time.Second, 10 * time.Second, 5 * time.Second, 10 * time.Second},
+		{100, time.Second, 10 * time.Second, 5 * time.Second, 10 * time.Second},
+		{1, time.Minute, 10 * time.Second, 5 * time.Second, 10 * time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			if got := backoffDelay(test.attempt, test.base, test.max); got < test.atLeast || got >= test.below {
+				t.Errorf("backoffDelay(%d, %s, %s) = %s, want from %s up to %s", test.attempt, test.base, test.max, got, test.atLeast, test.below)
+				break
+			}
+		}
+	}
+	// Too short to split is returned as it is
+	if got := backoffDelay(1, time.Nanosecond, time.Second); got != time.Nanosecond {
+		t.Errorf("backoffDelay(1, 1ns, 1s) = %s, want 1ns", got)
+	}
+	if got := backoffDelay(3, 0, time.Second); got != 0 {
+		t.Errorf("backoffDelay(3, 0, 1s) = %s, want 0", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"Sat, 09 Mar 2024 12:01:30 GMT", 90 * time.Second, true},
+		// A date that has passed means retry now
+		{"Sat, 09 Mar 2024 11:00:00 GMT", 0, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		if test.value != "" {
+			header.Set("Retry-After", test.value)
+		}
+		if got, ok := parseRetryAfter(&header, now); got != test.want || ok != test.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v, want %s, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+	if _, ok := parseRetryAfter(nil, now); ok {
+		t.Error("parseRetryAfter(nil) found a delay")
+	}
+}
+
+// breakerOpen reports whether the breaker is pausing requests
+func breakerOpen(b *circuitBreaker) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().Before(b.openUntil)
+}
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	breaker := newCircuitBreaker(0.5, 4, time.Hour)
+
+	// The rate isn't trusted until the window is full
+	for i := 0; i < 3; i++ {
+		breaker.record(true)
+	}
+	if breakerOpen(breaker) {
+		t.Fatal("opened after 3 of 4 responses")
+	}
+	breaker.record(false)
+	if !breakerOpen(breaker) {
+		t.Fatal("still closed with 3 bans in 4 responses")
+	}
+
+	// Below the threshold it stays closed, as the oldest responses drop out of the window
+	breaker = newCircuitBreaker(0.5, 4, time.Hour)
+	for _, banned := range []bool{true, false, false, false, true, false, false} {
+		breaker.record(banned)
+		if breakerOpen(breaker) {
+			t.Fatal("opened with 1 ban in 4 responses")
+		}
+	}
+	// Exactly at the threshold it opens
+	breaker.record(true)
+	if !breakerOpen(breaker) {
+		t.Error("still closed with 2 bans in 4 responses")
+	}
+}
+
+func TestCircuitBreakerResets(t *testing.T) {
+	breaker := newCircuitBreaker(0.5, 4, 50*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		breaker.record(true)
+	}
+	start := time.Now()
+	breaker.wait()
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("wait returned after %s, want the 50ms cooldown", waited)
+	}
+	if breakerOpen(breaker) {
+		t.Fatal("still open after the cooldown")
+	}
+
+	// The bans from before the pause don't count again: the window starts afresh
+	for i := 0; i < 3; i++ {
+		breaker.record(false)
+	}
+	breaker.record(true)
+	if breakerOpen(breaker) {
+		t.Error("opened again with 1 ban in the 4 responses since the pause")
+	}
+
+	// A closed breaker doesn't hold anything up
+	start = time.Now()
+	breaker.wait()
+	if waited := time.Since(start); waited > 10*time.Millisecond {
+		t.Errorf("a closed breaker waited %s", waited)
+	}
+}
+
+func TestLoadCircuitBreaker(t *testing.T) {
+	clearSettings(t)
+	breaker, err := loadCircuitBreaker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breaker.Threshold != 0.5 || breaker.MinSamples != 20 || len(breaker.outcomes) != 20 || breaker.Cooldown != 5*time.Minute {
+		t.Errorf("default breaker %+v", breaker)
+	}
+
+	t.Setenv("MMA_BREAKER_THRESHOLD", "0.25")
+	t.Setenv("MMA_BREAKER_WINDOW", "40")
+	t.Setenv("MMA_BREAKER_COOLDOWN", "1m")
+	breaker, err = loadCircuitBreaker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breaker.Threshold != 0.25 || breaker.MinSamples != 40 || len(breaker.outcomes) != 40 || breaker.Cooldown != time.Minute {
+		t.Errorf("breaker %+v, want 0.25 over 40 responses for 1m", breaker)
+	}
+
+	for env, value := range map[string]string{"MMA_BREAKER_THRESHOLD": "0", "MMA_BREAKER_WINDOW": "-1", "MMA_BREAKER_COOLDOWN": "soon"} {
+		clearSettings(t)
+		t.Setenv(env, value)
+		if _, err := loadCircuitBreaker(); err == nil || !strings.Contains(err.Error(), env) {
+			t.Errorf("%s=%s: error %v", env, value, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemaDescriptions documents the JSON fields that have no CSV column. The others are
+// described by csvColumnDescriptions, and a description tag on the field overrides both.
+var schemaDescriptions = map[string]string{
+	"schema_version":  "Version of this schema, bumped whenever a field is renamed, removed or changes meaning",
+	"generated_at":    "When the file was written",
+	"run_id":          "ID of the crawl run, also found in run_metadata.json",
+	"scraper_version": "VCS revision the scraper was built from",
+	"source":          "Where the run started crawling",
+	"politeness":      "The politeness settings the run crawled with, as in run_metadata.json. Absent when the file wasn't written by a crawl",
+	"name":            "Data source: html, api, or snapshot for exports of files without an envelope",
+	"url":             "First URL the run visited",
+	"counts":          "Number of fighters and rows in the file",
+	"fighters":        "The scraped fighters",
+	"fights":          "Fight history, most recent first",
+	"striking_stats":  "Striking stats per fight, most recent first",
+	"clinch_stats":    "Clinch stats per fight, most recent first",
+	"ground_stats":    "Ground stats per fight, most recent first",
+	"id":              "ESPN athlete ID",
+	"scraped_at":      "When the fighter's pages were last fetched",
+	"source_urls":     "Pages the fighter was assembled from",
+}
+
+// writeOutputJSONSchema writes the JSON Schema of fighters.json. It is generated from the
+// structs the scraper writes, so it can't drift from the actual output.
+func writeOutputJSONSchema(w io.Writer) error {
+	schema := jsonSchemaFor(reflect.TypeOf(outputEnvelope{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "MMA fighter data"
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
+
+// jsonSchemaFor describes a Go type the way encoding/json writes it
+func jsonSchemaFor(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Ptr:
+		return jsonSchemaFor(t.Elem())
+	case reflect.Slice:
+		// A nil slice is written as null
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": jsonSchemaFor(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := strings.Split(field.Tag.Get("json"), ",")
+			if field.PkgPath != "" || tag[0] == "-" {
+				continue
+			}
+			name := tag[0]
+			if name == "" {
+				name = field.Name
+			}
+
+			property := jsonSchemaFor(field.Type)
+			if description := field.Tag.Get("description"); description != "" {
+				property["description"] = description
+			} else if description, ok := schemaDescriptions[name]; ok {
+				property["description"] = description
+			} else if description, ok := csvColumnDescriptions[name]; ok {
+				property["description"] = description
+			}
+			properties[name] = property
+			if !containsString(tag[1:], "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]interface{}{}
+}
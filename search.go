@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Weights of the fields a fighter is found by. A match on the name ranks above the same match
+// on an alias or nickname.
+const (
+	nameWeight     = 1.0
+	aliasWeight    = 0.9
+	nicknameWeight = 0.7
+)
+
+// searchIndex finds fighters by name, nickname and alias, ignoring accents and tolerating typos
+type searchIndex struct {
+	docs []*searchDoc
+	byID map[string]*searchDoc
+}
+
+type searchDoc struct {
+	fighter *FighterStats
+	fields  []searchField
+}
+
+// searchField is one folded name a fighter is known by
+type searchField struct {
+	text   string
+	words  []string
+	joined []string // Adjacent words written as one, e.g. dossantos
+	weight float64
+}
+
+// searchResult is a fighter found by a search. Score is from 0 to 1; 1 is an exact match of
+// the whole name.
+type searchResult struct {
+	Fighter *FighterStats
+	Score   float64
+	Matched string // The name, alias or nickname that matched best
+}
+
+func newSearchIndex(fighters []*FighterStats) *searchIndex {
+	s := &searchIndex{byID: make(map[string]*searchDoc)}
+	for _, fighter := range fighters {
+		doc := &searchDoc{fighter: fighter}
+		s.docs = append(s.docs, doc)
+		s.byID[fighterID(fighter)] = doc
+
+		doc.add(fighterName(fighter), nameWeight)
+		doc.add(fighter.Nickname, nicknameWeight)
+		// The name in the URL of each page, which can be spelled differently from the header
+		for _, sourceURL := range fighter.SourceURLs {
+			parts := strings.Split(strings.TrimSuffix(sourceURL, "/"), "/")
+			if slug := parts[len(parts)-1]; !isDigits(slug) && !strings.Contains(slug, ".") {
+				doc.add(slug, aliasWeight)
+			}
+		}
+	}
+	return s
+}
+
+// addAlias makes a fighter findable by another name
+func (s *searchIndex) addAlias(id, alias string) {
+	if doc, ok := s.byID[id]; ok {
+		doc.add(alias, aliasWeight)
+	}
+}
+
+func (d *searchDoc) add(text string, weight float64) {
+	folded := foldName(text)
+	if folded == "" {
+		return
+	}
+	for _, field := range d.fields {
+		if field.text == folded {
+			return
+		}
+	}
+	field := searchField{text: folded, words: strings.Fields(folded), weight: weight}
+	for i := 1; i < len(field.words); i++ {
+		field.joined = append(field.joined, field.words[i-1]+field.words[i])
+	}
+	d.fields = append(d.fields, field)
+}
+
+// search returns the fighters matching every word of the query, best first. The last word may
+// be the start of a word, so results can be shown while typing.
+func (s *searchIndex) search(query string, limit int) []searchResult {
+	folded := foldName(query)
+	words := strings.Fields(folded)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var results []searchResult
+	for _, doc := range s.docs {
+		best := searchResult{Fighter: doc.fighter}
+		for _, field := range doc.fields {
+			score := matchField(field, folded, words) * field.weight
+			if score > best.Score {
+				best.Score, best.Matched = score, field.text
+			}
+		}
+		if best.Score > 0 {
+			results = append(results, best)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return fighterName(results[i].Fighter) < fighterName(results[j].Fighter)
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// matchField scores a field against the query words. Every query word has to match a word of
+// the field, exactly, as a prefix if it's the last, or within a few typos.
+func matchField(field searchField, query string, words []string) float64 {
+	if field.text == query {
+		return 1
+	}
+	// The whole name written without spaces
+	if strings.ReplaceAll(field.text, " ", "") == strings.ReplaceAll(query, " ", "") {
+		return 0.95
+	}
+
+	total := 0.0
+	for i, word := range words {
+		best := 0.0
+		for _, candidate := range field.words {
+			best = max(best, matchWord(word, candidate, i == len(words)-1))
+		}
+		for _, candidate := range field.joined {
+			best = max(best, 0.95*matchWord(word, candidate, i == len(words)-1))
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	// Scale to below an exact match, and prefer fields without extra words
+	score := 0.9 * total / float64(len(words))
+	if len(field.words) > len(words) {
+		score -= 0.05 * float64(len(field.words)-len(words)) / float64(len(field.words))
+	}
+	return score
+}
+
+func matchWord(word, candidate string, last bool) float64 {
+	switch {
+	case word == candidate:
+		return 1
+	case last && len(word) >= 2 && strings.HasPrefix(candidate, word):
+		return 0.8
+	}
+	allowed := typosAllowed(word)
+	if allowed == 0 {
+		return 0
+	}
+	if distance := editDistance(word, candidate, allowed); distance <= allowed {
+		return 0.75 - 0.2*float64(distance-1)
+	}
+	return 0
+}
+
+// typosAllowed is how many edits a word of this length may be off by: none for short words,
+// where one edit makes a different name, and up to two for long ones
+func typosAllowed(word string) int {
+	switch n := len([]rune(word)); {
+	case n <= 3:
+		return 0
+	case n <= 7:
+		return 1
+	}
+	return 2
+}
+
+// editDistance is the number of insertions, deletions, substitutions and transpositions of
+// adjacent letters between two words. It stops counting past limit.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+// runSearchCommand searches a snapshot for fighters by name, nickname or alias
+func runSearchCommand(args []string) error {
+	flags, v := newCommandFlags("search", "<name>")
+	data := flags.String("data", "", "snapshot to search (default the database or file the sinks write)")
+	limit := flags.Int("limit", 10, "most results to print")
+	if err := parseCommandFlags(flags, v, args, 1); err != nil {
+		return err
+	}
+	if *data == "" {
+		*data = defaultServeData()
+	}
+
+	snapshot, err := loadSnapshot(*data)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", *data, err)
+	}
+	results := newQueryIndex(*data, snapshot).search.search(flags.Arg(0), *limit)
+	if len(results) == 0 {
+		return fmt.Errorf("no fighter matches %q", flags.Arg(0))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCORE\tID\tNAME\tNICKNAME\tDIVISION\tMATCHED")
+	for _, result := range results {
+		fighter := result.Fighter
+		fmt.Fprintf(w, "%.2f\t%s\t%s\t%s\t%s\t%s\n", result.Score, fighterID(fighter), fighterName(fighter), fighter.Nickname, fighterDivision(fighter), result.Matched)
+	}
+	return w.Flush()
+}
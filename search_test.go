@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTyposAllowed(t *testing.T) {
+	tests := []struct {
+		word string
+		want int
+	}{
+		{"jon", 0},
+		{"jose", 1},
+		{"poirier", 1},
+		{"mcgregor", 2},
+		{"nurmagomedov", 2},
+		// Letters, not bytes
+		{"józé", 1},
+		{"jíř", 0},
+	}
+	for _, test := range tests {
+		if got := typosAllowed(test.word); got != test.want {
+			t.Errorf("typosAllowed(%q) = %d, want %d", test.word, got, test.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"mcgregor", "mcgregor", 2, 0},
+		{"mcgregor", "mcgreggor", 2, 1},
+		{"mcgregor", "mcgrgor", 2, 1},
+		{"mcgregor", "mcgregar", 2, 1},
+		// Swapping two adjacent letters is one edit
+		{"mcgregor", "mcgregro", 2, 1},
+		{"poirier", "porieir", 2, 2},
+		// Past the limit, the count stops at limit + 1
+		{"mcgregor", "poirier", 2, 3},
+		{"jon", "jonathan", 2, 3},
+		{"jon", "jones", 2, 2},
+		{"procházka", "prochazka", 1, 1},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b, test.limit); got != test.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", test.a, test.b, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestMatchWord(t *testing.T) {
+	tests := []struct {
+		word, candidate string
+		last            bool
+		want            float64
+	}{
+		{"mcgregor", "mcgregor", false, 1},
+		// Only the last word may be the start of a word, and of at least two letters
+		{"mcg", "mcgregor", true, 0.8},
+		{"mcg", "mcgregor", false, 0},
+		{"m", "mcgregor", true, 0},
+		// One typo, or two in a long word
+		{"mcgregr", "mcgregor", false, 0.75},
+		{"nurmagomedvo", "nurmagomedov", false, 0.75},
+		{"nurmagomdv", "nurmagomedov", false, 0.55},
+		{"nurmgomdv", "nurmagomedov", false, 0},
+		{"pirier", "poirier", false, 0.75},
+		{"pirer", "poirier", false, 0},
+		// Short words must match exactly
+		{"jon", "jan", false, 0},
+	}
+	for _, test := range tests {
+		if got := matchWord(test.word, test.candidate, test.last); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("matchWord(%q, %q, %v) = %v, want %v", test.word, test.candidate, test.last, got, test.want)
+		}
+	}
+}
+
+func TestMatchField(t *testing.T) {
+	doc := &searchDoc{}
+	doc.add("Junior dos Santos", nameWeight)
+	field := doc.fields[0]
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		{"Junior dos Santos", 1},
+		{"juniordossantos", 0.95},
+		// Two words of the field written as one
+		{"dossantos", 0.9*0.95 - 0.05*2/3},
+		{"junior santos", 0.9 - 0.05*1/3},
+		{"santos junior", 0.9 - 0.05*1/3},
+		{"santos jun", 0.9*1.8/2 - 0.05*1/3},
+		{"santos", 0.9 - 0.05*2/3},
+		{"junior silva", 0},
+	}
+	for _, test := range tests {
+		folded := foldName(test.query)
+		if got := matchField(field, folded, strings.Fields(folded)); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("matchField(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	fighters := []*FighterStats{
+		{ID: "1", FirstName: "José", LastName: "Aldo"},
+		{ID: "2", FirstName: "Brandon", LastName: "Moreno", Nickname: "Aldo"},
+		{ID: "3", FirstName: "Jiří", LastName: "Procházka"},
+		{ID: "4", FirstName: "Max", LastName: "Holloway"},
+		{ID: "5", FirstName: "Alex", LastName: "Holloway"},
+		{ID: "6", FirstName: "Junior", LastName: "dos Santos"},
+		{ID: "7", FirstName: "Conor", LastName: "McGregor", SourceURLs: []string{"https://www.espn.com/mma/fighter/_/id/7/connor-mcgregor"}},
+	}
+	index := newSearchIndex(fighters)
+	index.addAlias("4", "Aldo Holloway")
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		// Accents are ignored in the query and in the names
+		{"jose aldo", 0, []string{"1"}},
+		{"Jiri Prochazka", 0, []string{"3"}},
+		{"jíří procházka", 0, []string{"3"}},
+		// The name ranks above an alias, and an alias above a nickname
+		{"aldo", 0, []string{"1", "4", "2"}},
+		{"aldo", 2, []string{"1", "4"}},
+		// The same score is ordered by name
+		{"holloway", 0, []string{"5", "4"}},
+		// The last word may be unfinished, the others may not
+		{"jose al", 0, []string{"1"}},
+		{"jo aldo", 0, nil},
+		// Typos, swapped letters and joined words
+		{"prochazak", 0, []string{"3"}},
+		{"dossantos", 0, []string{"6"}},
+		// The name in a page's URL is an alias
+		{"connor", 0, []string{"7"}},
+		{"", 0, nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, result := range index.search(test.query, test.limit) {
+			got = append(got, result.Fighter.ID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("search(%q, %d) = %v, want %v", test.query, test.limit, got, test.want)
+		}
+	}
+}
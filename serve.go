@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultServeAddr = ":8080"
+	defaultPerPage   = 20
+	maxPerPage       = 100
+)
+
+// queryServer answers the query API from an index of the latest snapshot, reloaded in the
+// background so that the data follows the scraper's runs
+type queryServer struct {
+	Data   string // A snapshot loadSnapshot accepts: a file, database or PostgreSQL URL
+	Reload time.Duration
+
+	mu     sync.RWMutex
+	index  *queryIndex
+	schema graphql.Schema
+}
+
+// page is the envelope of every list response
+type page struct {
+	Data    interface{} `json:"data"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Total   int         `json:"total"`
+}
+
+// fighterDetail is a fighter with everything the API derives about them
+type fighterDetail struct {
+	FighterStats
+	Division string       `json:"division"`
+	Bouts    []*queryBout `json:"bouts"`
+}
+
+// headToHead is the record of two fighters against each other
+type headToHead struct {
+	Fighters [2]fighterSummary `json:"fighters"`
+	Wins     map[string]int    `json:"wins"` // Keyed by fighter ID
+	Bouts    []*queryBout      `json:"bouts"`
+}
+
+func runServeCommand(args []string) error {
+	flags, v := newCommandFlags("serve", "")
+	addr := flags.String("addr", "", "address to listen on (MMA_SERVE_ADDR, default :8080)")
+	data := flags.String("data", "", "snapshot to serve (MMA_SERVE_DATA, default the database or file the sinks write)")
+	reload := flags.String("reload", "", "how often to reload the data (MMA_SERVE_RELOAD, default 5m, 0 for never)")
+	if err := parseCommandFlags(flags, v, args, 0); err != nil {
+		return err
+	}
+
+	server := &queryServer{Data: *data, Reload: 5 * time.Minute}
+	if server.Data == "" {
+		server.Data = defaultServeData()
+	}
+	if *reload == "" {
+		*reload = os.Getenv("MMA_SERVE_RELOAD")
+	}
+	if *reload != "" {
+		var err error
+		if server.Reload, err = time.ParseDuration(*reload); err != nil {
+			return fmt.Errorf("invalid reload interval %q: %v", *reload, err)
+		}
+	}
+	if *addr == "" {
+		*addr = os.Getenv("MMA_SERVE_ADDR")
+	}
+	if *addr == "" {
+		*addr = defaultServeAddr
+	}
+
+	var err error
+	if server.schema, err = newGraphQLSchema(); err != nil {
+		return fmt.Errorf("building the GraphQL schema: %v", err)
+	}
+	if err := server.load(); err != nil {
+		return fmt.Errorf("loading %s: %v", server.Data, err)
+	}
+	if server.Reload > 0 {
+		go server.reloadEvery(server.Reload)
+	}
+
+	httpServer := &http.Server{
+		Addr:         *addr,
+		Handler:      server.handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	progressf("Serving %s on %s\n", server.Data, *addr)
+	return httpServer.ListenAndServe()
+}
+
+// defaultServeData is MMA_SERVE_DATA, or else the store the configured sinks write to,
+// preferring the databases over the JSON file
+func defaultServeData() string {
+	if env := os.Getenv("MMA_SERVE_DATA"); env != "" {
+		return env
+	}
+	sinks := strings.Split(os.Getenv("MMA_SINKS"), ",")
+	for i := range sinks {
+		sinks[i] = strings.TrimSpace(sinks[i])
+	}
+	if containsString(sinks, "postgres") && os.Getenv("MMA_POSTGRES_URL") != "" {
+		return os.Getenv("MMA_POSTGRES_URL")
+	}
+	if containsString(sinks, "sqlite") {
+		if path := os.Getenv("MMA_SQLITE_PATH"); path != "" {
+			return path
+		}
+		return defaultSQLitePath
+	}
+	if path := os.Getenv("MMA_OUTPUT_FILE"); path != "" {
+		return path
+	}
+	return defaultOutputFile
+}
+
+func (s *queryServer) load() error {
+	snapshot, err := loadSnapshot(s.Data)
+	if err != nil {
+		return err
+	}
+	index := newQueryIndex(s.Data, snapshot)
+
+	s.mu.Lock()
+	s.index = index
+	s.mu.Unlock()
+	debugf("Loaded %d fighters and %d events from %s\n", len(index.fighters), len(index.events), s.Data)
+	return nil
+}
+
+// reloadEvery reloads the data in the background. A failed reload keeps serving the last data.
+func (s *queryServer) reloadEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.load(); err != nil {
+			log.Printf("Error reloading %s, still serving the data loaded at %s: %v", s.Data, s.current().LoadedAt.Format(time.RFC3339), err)
+		}
+	}
+}
+
+func (s *queryServer) current() *queryIndex {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.index
+}
+
+func (s *queryServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/health", s.handleHealth)
+	mux.HandleFunc("GET /api/fighters", s.handleFighters)
+	mux.HandleFunc("GET /api/fighters/{id}", s.handleFighter)
+	mux.HandleFunc("GET /api/events", s.handleEvents)
+	mux.HandleFunc("GET /api/events/{id}", s.handleEvent)
+	mux.HandleFunc("GET /api/bouts/{id}", s.handleBout)
+	mux.HandleFunc("GET /api/head-to-head", s.handleHeadToHead)
+	mux.HandleFunc("GET /api/graphql", s.handleGraphQL)
+	mux.HandleFunc("POST /api/graphql", s.handleGraphQL)
+	return withCORS(mux)
+}
+
+// withCORS lets a frontend on another origin read the API. Everything it serves is public.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if r.Method == http.MethodOptions {
+			// The preflight of a JSON POST to the GraphQL endpoint
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *queryServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	index := s.current()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"run_id":    index.RunID,
+		"loaded_at": index.LoadedAt,
+		"fighters":  len(index.fighters),
+		"events":    len(index.events),
+	})
+}
+
+// handleFighters lists fighters, filtered by division, stance and team. With q, a name,
+// nickname or alias, they are searched for and ranked best match first.
+func (s *queryServer) handleFighters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageNumber, perPage, err := parsePagination(query.Get("page"), query.Get("per_page"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	found, scores := s.current().findFighters(fighterFilter{
+		Query:    query.Get("q"),
+		Division: query.Get("division"),
+		Stance:   query.Get("stance"),
+		Team:     query.Get("team"),
+	})
+	summaries := []fighterSummary{}
+	for _, fighter := range paginate(found, pageNumber, perPage) {
+		summary := summarizeFighter(fighter)
+		summary.Score = scores[fighter]
+		summaries = append(summaries, summary)
+	}
+	writeJSON(w, http.StatusOK, page{Data: summaries, Page: pageNumber, PerPage: perPage, Total: len(found)})
+}
+
+func (s *queryServer) handleFighter(w http.ResponseWriter, r *http.Request) {
+	index := s.current()
+	fighter, ok := index.byID[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no fighter with ID "+r.PathValue("id"))
+		return
+	}
+	bouts := index.bouts[fighterID(fighter)]
+	if bouts == nil {
+		bouts = []*queryBout{}
+	}
+	writeJSON(w, http.StatusOK, fighterDetail{FighterStats: *fighter, Division: fighterDivision(fighter), Bouts: bouts})
+}
+
+// handleEvents lists events, most recent first, without their bouts
+func (s *queryServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageNumber, perPage, err := parsePagination(query.Get("page"), query.Get("per_page"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	type eventSummary struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Date  string `json:"date"`
+		Bouts int    `json:"bouts"`
+	}
+	events := s.current().events
+	summaries := []eventSummary{}
+	for _, event := range paginate(events, pageNumber, perPage) {
+		summaries = append(summaries, eventSummary{event.ID, event.Name, event.Date, len(event.Bouts)})
+	}
+	writeJSON(w, http.StatusOK, page{Data: summaries, Page: pageNumber, PerPage: perPage, Total: len(events)})
+}
+
+func (s *queryServer) handleEvent(w http.ResponseWriter, r *http.Request) {
+	event, ok := s.current().eventsByID[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no event with ID "+r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, event)
+}
+
+func (s *queryServer) handleBout(w http.ResponseWriter, r *http.Request) {
+	bout, ok := s.current().boutsByID[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no bout with ID "+r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, bout)
+}
+
+// handleHeadToHead compares the fighters given as ?a=ID&b=ID
+func (s *queryServer) handleHeadToHead(w http.ResponseWriter, r *http.Request) {
+	index := s.current()
+	var fighters [2]*FighterStats
+	for i, param := range []string{"a", "b"} {
+		id := r.URL.Query().Get(param)
+		if id == "" {
+			writeError(w, http.StatusBadRequest, "head-to-head needs two fighter IDs, as ?a=ID&b=ID")
+			return
+		}
+		fighter, ok := index.byID[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "no fighter with ID "+id)
+			return
+		}
+		fighters[i] = fighter
+	}
+
+	a, b := fighterID(fighters[0]), fighterID(fighters[1])
+	result := headToHead{
+		Fighters: [2]fighterSummary{summarizeFighter(fighters[0]), summarizeFighter(fighters[1])},
+		Wins:     map[string]int{a: 0, b: 0},
+		Bouts:    index.headToHead(a, b),
+	}
+	for _, bout := range result.Bouts {
+		for _, corner := range bout.Corners {
+			if strings.EqualFold(corner.Result, "W") {
+				result.Wins[corner.ID]++
+			}
+		}
+	}
+	if result.Bouts == nil {
+		result.Bouts = []*queryBout{}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// parsePagination reads the page (from 1) and per_page parameters
+func parsePagination(pageParam, perPageParam string) (int, int, error) {
+	pageNumber, perPage := 1, defaultPerPage
+	if pageParam != "" {
+		n, err := strconv.Atoi(pageParam)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid page %q", pageParam)
+		}
+		pageNumber = n
+	}
+	if perPageParam != "" {
+		n, err := strconv.Atoi(perPageParam)
+		if err != nil || n < 1 || n > maxPerPage {
+			return 0, 0, fmt.Errorf("invalid per_page %q, expected 1 to %d", perPageParam, maxPerPage)
+		}
+		perPage = n
+	}
+	return pageNumber, perPage, nil
+}
+
+// paginate returns one page of a list. The page number is checked against the page count
+// before it is multiplied, so a huge ?page= can't overflow into a valid offset.
+func paginate[T any](items []T, pageNumber, perPage int) []T {
+	if pageNumber < 1 || pageNumber-1 > len(items)/perPage {
+		return nil
+	}
+	start := (pageNumber - 1) * perPage
+	if start >= len(items) {
+		return nil
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSnapshot is two fighters who fought each other, as each of their records has it
+func testSnapshot() *outputEnvelope {
+	return &outputEnvelope{
+		SchemaVersion: outputSchemaVersion,
+		RunID:         "test-run",
+		Fighters: []FighterStats{
+			{
+				ID: "3022677", FirstName: "Conor", LastName: "McGregor", Nickname: "The Notorious",
+				HeightAndWeight: `5' 9", 155 lbs`, Stance: "Southpaw", WinLossRecord: "22-6-0",
+				Fights: []Fight{{Date: "Jul 10, 2021", Opponent: "Dustin Poirier", Event: "UFC 264", Result: "L", Decision: "KO/TKO", Rnd: "1", Time: "5:00"}},
+			},
+			{
+				ID: "2335639", FirstName: "Dustin", LastName: "Poirier", Nickname: "The Diamond",
+				HeightAndWeight: `5' 9", 155 lbs`, Stance: "Southpaw", WinLossRecord: "30-8-0",
+				Fights: []Fight{{Date: "Jul 10, 2021", Opponent: "Conor McGregor", Event: "UFC 264", Result: "W", Decision: "KO/TKO", Rnd: "1", Time: "5:00"}},
+			},
+		},
+	}
+}
+
+// newTestQueryServer serves testSnapshot without loading anything from disk
+func newTestQueryServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	schema, err := newGraphQLSchema()
+	if err != nil {
+		t.Fatalf("building the GraphQL schema: %v", err)
+	}
+	server := &queryServer{Data: "test", index: newQueryIndex("test", testSnapshot()), schema: schema}
+	httpServer := httptest.NewServer(server.handler())
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// getJSON GETs a path of the test server and decodes the response into v
+func getJSON(t *testing.T, server *httptest.Server, path string, v interface{}) int {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: decoding the response: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+// postGraphQL POSTs a query to the test server's GraphQL endpoint
+func postGraphQL(t *testing.T, server *httptest.Server, query string) (int, map[string]interface{}) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": query})
+	resp, err := http.Post(server.URL+"/api/graphql", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("POST /api/graphql: %v", err)
+	}
+	defer resp.Body.Close()
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("POST /api/graphql: decoding the response: %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		page, perPage int
+		want          []int
+	}{
+		{1, 2, []int{1, 2}},
+		{3, 2, []int{5}},
+		{4, 2, nil},
+		{1, 10, []int{1, 2, 3, 4, 5}},
+		{0, 2, nil},
+		// (page-1)*per_page wraps around to 0 here
+		{1<<62 + 1, 4, nil},
+		{math.MaxInt, 100, nil},
+	}
+	for _, test := range tests {
+		if got := paginate(items, test.page, test.perPage); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("paginate(page %d, per page %d) = %v, want %v", test.page, test.perPage, got, test.want)
+		}
+	}
+}
+
+func TestFighterDivision(t *testing.T) {
+	tests := []struct {
+		heightAndWeight, want string
+	}{
+		{`5' 9", 155 lbs`, "Lightweight"},
+		{`5' 4", 115 lbs`, "Strawweight"},
+		{`5' 6", 116 lbs`, "Flyweight"},
+		{`6' 4", 265 lbs`, "Heavyweight"},
+		{`6' 8", 280 lbs`, ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := fighterDivision(&FighterStats{HeightAndWeight: test.heightAndWeight}); got != test.want {
+			t.Errorf("fighterDivision(%q) = %q, want %q", test.heightAndWeight, got, test.want)
+		}
+	}
+}
+
+// fighterPage is a page of the fighters list
+type fighterPage struct {
+	Data    []fighterSummary `json:"data"`
+	Page    int              `json:"page"`
+	PerPage int              `json:"per_page"`
+	Total   int              `json:"total"`
+}
+
+func TestListFighters(t *testing.T) {
+	server := newTestQueryServer(t)
+	tests := []struct {
+		path    string
+		wantIDs []string
+		total   int
+	}{
+		{"/api/fighters", []string{"3022677", "2335639"}, 2},
+		{"/api/fighters?per_page=1&page=2", []string{"2335639"}, 2},
+		{"/api/fighters?division=lightweight", []string{"3022677", "2335639"}, 2},
+		{"/api/fighters?division=heavyweight", nil, 0},
+		{"/api/fighters?q=poirier", []string{"2335639"}, 1},
+		{"/api/fighters?page=4611686018427387905&per_page=4", nil, 2},
+	}
+	for _, test := range tests {
+		var got fighterPage
+		if status := getJSON(t, server, test.path, &got); status != http.StatusOK {
+			t.Errorf("GET %s: status %d", test.path, status)
+			continue
+		}
+		var ids []string
+		for _, fighter := range got.Data {
+			ids = append(ids, fighter.ID)
+		}
+		if !reflect.DeepEqual(ids, test.wantIDs) || got.Total != test.total {
+			t.Errorf("GET %s: IDs %v of %d, want %v of %d", test.path, ids, got.Total, test.wantIDs, test.total)
+		}
+	}
+
+	for _, path := range []string{"/api/fighters?page=0", "/api/fighters?page=x", "/api/fighters?per_page=101"} {
+		var got map[string]string
+		if status := getJSON(t, server, path, &got); status != http.StatusBadRequest || got["error"] == "" {
+			t.Errorf("GET %s: status %d, error %q, want 400", path, status, got["error"])
+		}
+	}
+}
+
+func TestGetFighter(t *testing.T) {
+	server := newTestQueryServer(t)
+	var got fighterDetail
+	if status := getJSON(t, server, "/api/fighters/3022677", &got); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if got.LastName != "McGregor" || got.Division != "Lightweight" || len(got.Bouts) != 1 {
+		t.Errorf("fighter %+v", got)
+	}
+	if bout := got.Bouts[0]; bout.EventID != "2021-07-10-ufc-264" || bout.Corners[0].ID == "" || bout.Corners[1].ID == "" {
+		t.Errorf("bout %+v", bout)
+	}
+
+	var missing map[string]string
+	if status := getJSON(t, server, "/api/fighters/1", &missing); status != http.StatusNotFound {
+		t.Errorf("unknown fighter: status %d, want 404", status)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := newTestQueryServer(t)
+	var events struct {
+		Data []struct {
+			ID    string `json:"id"`
+			Bouts int    `json:"bouts"`
+		} `json:"data"`
+		Total int `json:"total"`
+	}
+	if status := getJSON(t, server, "/api/events", &events); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	// Both fighters' records of the same fight make one bout
+	if events.Total != 1 || len(events.Data) != 1 || events.Data[0].ID != "2021-07-10-ufc-264" || events.Data[0].Bouts != 1 {
+		t.Fatalf("events %+v", events)
+	}
+
+	var event queryEvent
+	if status := getJSON(t, server, "/api/events/2021-07-10-ufc-264", &event); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if event.Name != "UFC 264" || len(event.Bouts) != 1 {
+		t.Errorf("event %+v", event)
+	}
+
+	var bout queryBout
+	if status := getJSON(t, server, "/api/bouts/"+event.Bouts[0].ID, &bout); status != http.StatusOK || bout.ID != event.Bouts[0].ID {
+		t.Errorf("bout %s: status %d, %+v", event.Bouts[0].ID, status, bout)
+	}
+
+	var missing map[string]string
+	if status := getJSON(t, server, "/api/events/2021-07-10-ufc-999", &missing); status != http.StatusNotFound {
+		t.Errorf("unknown event: status %d, want 404", status)
+	}
+}
+
+func TestHeadToHead(t *testing.T) {
+	server := newTestQueryServer(t)
+	var got headToHead
+	if status := getJSON(t, server, "/api/head-to-head?a=3022677&b=2335639", &got); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if got.Wins["2335639"] != 1 || got.Wins["3022677"] != 0 || len(got.Bouts) != 1 {
+		t.Errorf("head-to-head %+v", got)
+	}
+
+	var missing map[string]string
+	if status := getJSON(t, server, "/api/head-to-head?a=3022677", &missing); status != http.StatusBadRequest {
+		t.Errorf("one fighter: status %d, want 400", status)
+	}
+}
+
+// One record spells the name with an accent and the opponent's without; both sides still make
+// one bout with both corners filled
+func TestBoutsPairAccentedNames(t *testing.T) {
+	index := newQueryIndex("test", &outputEnvelope{Fighters: []FighterStats{
+		{
+			ID: "2335479", FirstName: "José", LastName: "Aldo",
+			Fights: []Fight{{Date: "Dec 12, 2015", Opponent: "Conor McGregor", Event: "UFC 194", Result: "L", Decision: "KO/TKO", Rnd: "1", Time: "0:13"}},
+		},
+		{
+			ID: "3022677", FirstName: "Conor", LastName: "McGregor",
+			Fights: []Fight{{Date: "Dec 12, 2015", Opponent: "Jose Aldo", Event: "UFC 194", Result: "W", Decision: "KO/TKO", Rnd: "1", Time: "0:13"}},
+		},
+	}})
+
+	if len(index.events) != 1 || len(index.events[0].Bouts) != 1 {
+		t.Fatalf("events %+v, want one event with one bout", index.events)
+	}
+	bout := index.events[0].Bouts[0]
+	if bout.ID != "2015-12-12-ufc-194--conor-mcgregor--jose-aldo" {
+		t.Errorf("bout ID %q", bout.ID)
+	}
+	if bout.Corners[0].ID != "3022677" || bout.Corners[0].Result != "W" || bout.Corners[1].ID != "2335479" || bout.Corners[1].Result != "L" {
+		t.Errorf("corners %+v", bout.Corners)
+	}
+	if len(index.bouts["2335479"]) != 1 || len(index.bouts["3022677"]) != 1 {
+		t.Errorf("bouts per fighter %d and %d, want 1 each", len(index.bouts["2335479"]), len(index.bouts["3022677"]))
+	}
+}
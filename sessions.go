@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"sync"
+
+	"github.com/gocolly/colly"
+)
+
+const defaultProfileFile = "profiles.json"
+
+// browserProfile is the set of headers a single browser sends, kept together so that a
+// session never mixes headers from different browsers
+type browserProfile struct {
+	Name           string            `json:"name"`
+	UserAgent      string            `json:"user_agent"`
+	Accept         string            `json:"accept"`
+	AcceptLanguage string            `json:"accept_language"`
+	Headers        map[string]string `json:"headers"` // Any other headers the browser sends, e.g. Sec-CH-UA
+}
+
+var defaultBrowserProfiles = []browserProfile{
+	{
+		Name:           "chrome-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		AcceptLanguage: "en-US,en;q=0.9",
+		Headers: map[string]string{
+			"Sec-CH-UA":          `"Chromium";v="140", "Not=A?Brand";v="24", "Google Chrome";v="140"`,
+			"Sec-CH-UA-Mobile":   "?0",
+			"Sec-CH-UA-Platform": `"Windows"`,
+		},
+	},
+	{
+		Name:           "chrome-mac",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		AcceptLanguage: "en-US,en;q=0.9",
+		Headers: map[string]string{
+			"Sec-CH-UA":          `"Chromium";v="140", "Not=A?Brand";v="24", "Google Chrome";v="140"`,
+			"Sec-CH-UA-Mobile":   "?0",
+			"Sec-CH-UA-Platform": `"macOS"`,
+		},
+	},
+	{
+		Name:           "edge-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36 Edg/140.0.0.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		AcceptLanguage: "en-US,en;q=0.9",
+		Headers: map[string]string{
+			"Sec-CH-UA":          `"Chromium";v="140", "Not=A?Brand";v="24", "Microsoft Edge";v="140"`,
+			"Sec-CH-UA-Mobile":   "?0",
+			"Sec-CH-UA-Platform": `"Windows"`,
+		},
+	},
+	{
+		Name:           "firefox-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:143.0) Gecko/20100101 Firefox/143.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.5",
+	},
+	{
+		Name:           "safari-mac",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.0 Safari/605.1.15",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+}
+
+// loadBrowserProfiles reads profiles from the JSON file named by MMA_PROFILE_FILE (default
+// profiles.json), falling back to the built-in profiles when the default file doesn't exist
+func loadBrowserProfiles() ([]browserProfile, error) {
+	path := os.Getenv("MMA_PROFILE_FILE")
+	if path == "" {
+		path = defaultProfileFile
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && path == defaultProfileFile {
+		return defaultBrowserProfiles, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []browserProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(profiles) == 0 {
+		return defaultBrowserProfiles, nil
+	}
+	// A profile without a User-Agent would give the session away on its first request
+	for i, profile := range profiles {
+		if profile.UserAgent == "" {
+			return nil, fmt.Errorf("%s: profile %d (%s) has no user_agent", path, i+1, profile.Name)
+		}
+	}
+	return profiles, nil
+}
+
+// session is the identity a single proxy presents: one browser profile and its own cookies
+type session struct {
+	profile browserProfile
+	jar     http.CookieJar
+}
+
+// apply sets the session's headers and cookies on an outgoing request
+func (s *session) apply(req *http.Request) {
+	req.Header.Set("User-Agent", s.profile.UserAgent)
+	if s.profile.Accept != "" {
+		req.Header.Set("Accept", s.profile.Accept)
+	}
+	if s.profile.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", s.profile.AcceptLanguage)
+	}
+	for key, value := range s.profile.Headers {
+		req.Header.Set(key, value)
+	}
+	for _, cookie := range s.jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+}
+
+// sessionManager hands out one session per proxy, created on first use
+type sessionManager struct {
+	profiles []browserProfile
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionManager(profiles []browserProfile) *sessionManager {
+	return &sessionManager{
+		profiles: profiles,
+		sessions: make(map[string]*session),
+	}
+}
+
+// sessionFor returns the session for a proxy, or for direct connections when proxyURL is empty
+func (m *sessionManager) sessionFor(proxyURL string) *session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[proxyURL]; ok {
+		return s
+	}
+	// cookiejar.New only fails on a bad PublicSuffixList, and none is passed
+	jar, _ := cookiejar.New(nil)
+	s := &session{
+		profile: m.profiles[rand.Intn(len(m.profiles))],
+		jar:     jar,
+	}
+	m.sessions[proxyURL] = s
+	return s
+}
+
+// transport wraps base so that every request carries the headers and cookies of the
+// session belonging to the proxy it goes through. The collector's own cookie jar should be
+// disabled, since cookies are kept per session here.
+func (m *sessionManager) transport(base http.RoundTripper) http.RoundTripper {
+	return &sessionTransport{sessions: m, base: base}
+}
+
+type sessionTransport struct {
+	sessions *sessionManager
+	base     http.RoundTripper
+}
+
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxyURL, _ := req.Context().Value(colly.ProxyURLKey).(string)
+	s := t.sessions.sessionFor(proxyURL)
+
+	req = req.Clone(req.Context())
+	s.apply(req)
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			s.jar.SetCookies(req.URL, cookies)
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gocolly/colly"
+)
+
+func TestLoadBrowserProfiles(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		want    string // An error containing this, or "" for none
+		count   int
+	}{
+		{`[{"name": "test", "user_agent": "Test/1.0", "headers": {"Sec-CH-UA-Mobile": "?0"}}]`, "", 1},
+		{`[]`, "", len(defaultBrowserProfiles)},
+		{`[{"name": "test", "user_agent": "Test/1.0"},`, "unexpected end of JSON input", 0},
+		{`{"name": "test", "user_agent": "Test/1.0"}`, "cannot unmarshal object", 0},
+		{`[{"name": "test", "user_agent": 1}]`, "cannot unmarshal number", 0},
+		{`[{"name": "test", "user_agent": "Test/1.0"}, {"name": "no-agent", "accept": "*/*"}]`, "profile 2 (no-agent) has no user_agent", 0},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, "profiles.json")
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("MMA_PROFILE_FILE", path)
+		profiles, err := loadBrowserProfiles()
+		if test.want == "" {
+			if err != nil || len(profiles) != test.count {
+				t.Errorf("test %d: %d profiles, %v, want %d", i, len(profiles), err, test.count)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.want) || !strings.Contains(err.Error(), path) {
+			t.Errorf("test %d: error %v, want one naming the file and containing %q", i, err, test.want)
+		}
+	}
+
+	// A missing profile file is only fine when it is the default one
+	t.Setenv("MMA_PROFILE_FILE", filepath.Join(dir, "missing.json"))
+	if _, err := loadBrowserProfiles(); err == nil {
+		t.Error("no error for a missing MMA_PROFILE_FILE")
+	}
+}
+
+// roundTripFunc turns a function into an http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Every request through a proxy has the same browser headers and that proxy's cookies, and no
+// other proxy's
+func TestSessionsStickToProxies(t *testing.T) {
+	var profiles []browserProfile
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		profiles = append(profiles, browserProfile{Name: name, UserAgent: "Test/" + name, AcceptLanguage: name, Headers: map[string]string{"X-Profile": name}})
+	}
+
+	var sent []*http.Request
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, req)
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}
+		// Each proxy's first request is given a cookie naming the proxy
+		if len(req.Cookies()) == 0 {
+			proxyURL, _ := req.Context().Value(colly.ProxyURLKey).(string)
+			resp.Header.Add("Set-Cookie", "proxy="+strings.TrimPrefix(proxyURL, "http://")+"; Path=/")
+		}
+		return resp, nil
+	})
+	transport := newSessionManager(profiles).transport(base)
+
+	proxies := []string{"http://proxy1.example.com:8080", "http://proxy2.example.com:8080", "http://proxy1.example.com:8080", "", "http://proxy2.example.com:8080", "http://proxy1.example.com:8080", ""}
+	for _, proxyURL := range proxies {
+		req, err := http.NewRequest("GET", "https://www.espn.com/mma/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proxyURL != "" {
+			req = req.WithContext(context.WithValue(req.Context(), colly.ProxyURLKey, proxyURL))
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	first := make(map[string]*http.Request)
+	for i, req := range sent {
+		proxyURL := proxies[i]
+		earlier, ok := first[proxyURL]
+		if !ok {
+			first[proxyURL] = req
+			if cookies := req.Cookies(); len(cookies) != 0 {
+				t.Errorf("first request through %q has cookies %v", proxyURL, cookies)
+			}
+			continue
+		}
+		for _, header := range []string{"User-Agent", "Accept-Language", "X-Profile"} {
+			if req.Header.Get(header) != earlier.Header.Get(header) {
+				t.Errorf("request %d through %q has %s %q, the first had %q", i, proxyURL, header, req.Header.Get(header), earlier.Header.Get(header))
+			}
+		}
+		want := "proxy=" + strings.TrimPrefix(proxyURL, "http://")
+		if cookies := req.Cookies(); len(cookies) != 1 || cookies[0].String() != want {
+			t.Errorf("request %d through %q has cookies %v, want %s", i, proxyURL, cookies, want)
+		}
+	}
+}
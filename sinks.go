@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultOutputFile = "fighters.json"
+
+// Sink receives the scraped fighters at the end of a run
+type Sink interface {
+	// Name describes the sink in log messages
+	Name() string
+	Write(fighters []FighterStats) error
+}
+
+// migrator is implemented by sinks that keep a database schema up to date
+type migrator interface {
+	Migrate() error
+}
+
+// streamer is implemented by sinks that take each fighter as soon as it is complete, during
+// the crawl. They still get the full list from Write at the end of the run.
+type streamer interface {
+	WriteFighter(fighter FighterStats) error
+}
+
+// fileSink writes the fighters to a local JSON file, wrapped in the output envelope
+type fileSink struct {
+	Path string
+	Run  *runInfo
+}
+
+func (s *fileSink) Name() string {
+	return s.Path
+}
+
+func (s *fileSink) Write(fighters []FighterStats) error {
+	jsonData, err := json.MarshalIndent(newOutputEnvelope(s.Run, fighters), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, jsonData, 0644)
+}
+
+// stdoutSink prints the fighters as JSON, wrapped in the output envelope
+type stdoutSink struct {
+	Run *runInfo
+}
+
+func (s *stdoutSink) Name() string {
+	return "stdout"
+}
+
+func (s *stdoutSink) Write(fighters []FighterStats) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newOutputEnvelope(s.Run, fighters))
+}
+
+// httpSink POSTs the fighters as JSON to an HTTP endpoint, in batches so that no single
+// request gets too large. Each batch carries an idempotency key derived from its contents, so
+// a batch that is retried after the server already stored it is not stored twice.
+type httpSink struct {
+	URL         string
+	Headers     map[string]string
+	Token       string // Sent as a bearer token when set
+	BatchSize   int    // Fighters per request
+	MaxAttempts int    // Attempts per batch on 5xx, 429 and network errors
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	client *http.Client
+}
+
+// uploadSummary counts the batches and fighters the endpoint accepted and rejected
+type uploadSummary struct {
+	AcceptedBatches  int
+	RejectedBatches  int
+	AcceptedFighters int
+	RejectedFighters int
+}
+
+func newHTTPSink(url string, headers map[string]string, token string, batchSize int) *httpSink {
+	return &httpSink{
+		URL:         url,
+		Headers:     headers,
+		Token:       token,
+		BatchSize:   batchSize,
+		MaxAttempts: 5,
+		BaseDelay:   2 * time.Second,
+		MaxDelay:    time.Minute,
+		client:      &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+func (s *httpSink) Name() string {
+	return s.URL
+}
+
+func (s *httpSink) Write(fighters []FighterStats) error {
+	var summary uploadSummary
+	batchCount := (len(fighters) + s.BatchSize - 1) / s.BatchSize
+	for start := 0; start < len(fighters); start += s.BatchSize {
+		end := start + s.BatchSize
+		if end > len(fighters) {
+			end = len(fighters)
+		}
+		batch := fighters[start:end]
+
+		if err := s.sendBatch(batch); err != nil {
+			log.Printf("Batch %d/%d rejected by %s: %v", start/s.BatchSize+1, batchCount, s.URL, err)
+			summary.RejectedBatches++
+			summary.RejectedFighters += len(batch)
+		} else {
+			summary.AcceptedBatches++
+			summary.AcceptedFighters += len(batch)
+		}
+	}
+
+	log.Printf("Upload to %s: %d batches accepted (%d fighters), %d batches rejected (%d fighters)",
+		s.URL, summary.AcceptedBatches, summary.AcceptedFighters, summary.RejectedBatches, summary.RejectedFighters)
+	if summary.RejectedBatches > 0 {
+		return fmt.Errorf("%d of %d batches rejected", summary.RejectedBatches, batchCount)
+	}
+	return nil
+}
+
+// sendBatch POSTs one batch with an idempotency key derived from its contents
+func (s *httpSink) sendBatch(batch []FighterStats) error {
+	jsonData, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(jsonData)
+	return s.send(jsonData, hex.EncodeToString(hash[:16]), nil)
+}
+
+// send POSTs a JSON body, retrying with backoff on network errors, 5xx and 429. prepare, when
+// set, is called before every attempt to set headers that change between attempts, such as a
+// signature's timestamp.
+func (s *httpSink) send(jsonData []byte, idempotencyKey string, prepare func(header http.Header)) error {
+	for attempt := 1; ; attempt++ {
+		statusCode, retryAfter, err := s.post(jsonData, idempotencyKey, prepare)
+		if err == nil && statusCode >= 200 && statusCode <= 299 {
+			return nil
+		}
+
+		retryable := err != nil || statusCode >= 500 || statusCode == http.StatusTooManyRequests
+		if err == nil {
+			err = fmt.Errorf("unexpected status code %d", statusCode)
+		}
+		if !retryable || attempt >= s.MaxAttempts {
+			return err
+		}
+
+		delay := backoffDelay(attempt, s.BaseDelay, s.MaxDelay)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		log.Printf("POST to %s failed (%v), retrying in %s", s.URL, err, delay.Round(time.Second))
+		time.Sleep(delay)
+	}
+}
+
+// post sends a single request and returns its status code and Retry-After delay
+func (s *httpSink) post(jsonData []byte, idempotencyKey string, prepare func(header http.Header)) (int, time.Duration, error) {
+	// Create a new POST request with the JSON data
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(jsonData))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Set the content type to application/json
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	for key, value := range s.Headers {
+		req.Header.Set(key, value)
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	if prepare != nil {
+		prepare(req.Header)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	retryAfter, _ := parseRetryAfter(&resp.Header, time.Now())
+	return resp.StatusCode, retryAfter, nil
+}
+
+// loadSinks builds the sinks named in MMA_SINKS, a comma-separated list of "file", "http",
+// "ndjson", "stdout", "csv", "parquet", "sqlite" and "postgres" that defaults to "file".
+// The file sink writes to MMA_OUTPUT_FILE (default fighters.json), and the NDJSON sink streams
+// to MMA_NDJSON_FILE (default fighters.ndjson). The HTTP sink posts to MMA_HTTP_SINK_URL with
+// the headers in MMA_HTTP_SINK_HEADERS ("Name=Value,Name=Value") and the bearer token in
+// MMA_HTTP_SINK_TOKEN, MMA_HTTP_SINK_BATCH_SIZE fighters at a time (default 100). The CSV and
+// Parquet sinks write their files into MMA_CSV_DIR (default csv) and MMA_PARQUET_DIR (default
+// parquet). The SQLite sink writes to MMA_SQLITE_PATH (default fighters.db), and the
+// PostgreSQL sink connects to MMA_POSTGRES_URL.
+func loadSinks(run *runInfo) ([]Sink, error) {
+	names := os.Getenv("MMA_SINKS")
+	if names == "" {
+		names = "file"
+	}
+
+	var sinks []Sink
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "file":
+			path := os.Getenv("MMA_OUTPUT_FILE")
+			if path == "" {
+				path = defaultOutputFile
+			}
+			sinks = append(sinks, &fileSink{Path: path, Run: run})
+		case "ndjson":
+			path := os.Getenv("MMA_NDJSON_FILE")
+			if path == "" {
+				path = defaultNDJSONFile
+			}
+			sinks = append(sinks, &ndjsonSink{Path: path})
+		case "stdout":
+			sinks = append(sinks, &stdoutSink{Run: run})
+		case "sqlite":
+			path := os.Getenv("MMA_SQLITE_PATH")
+			if path == "" {
+				path = defaultSQLitePath
+			}
+			sinks = append(sinks, &sqliteSink{Path: path})
+		case "csv":
+			dir := os.Getenv("MMA_CSV_DIR")
+			if dir == "" {
+				dir = defaultCSVDir
+			}
+			sinks = append(sinks, &csvSink{Dir: dir})
+		case "parquet":
+			dir := os.Getenv("MMA_PARQUET_DIR")
+			if dir == "" {
+				dir = defaultParquetDir
+			}
+			sinks = append(sinks, &parquetSink{Dir: dir})
+		case "postgres":
+			url := os.Getenv("MMA_POSTGRES_URL")
+			if url == "" {
+				return nil, fmt.Errorf("the postgres sink needs MMA_POSTGRES_URL")
+			}
+			sinks = append(sinks, &postgresSink{URL: url})
+		case "http":
+			url := os.Getenv("MMA_HTTP_SINK_URL")
+			if url == "" {
+				return nil, fmt.Errorf("the http sink needs MMA_HTTP_SINK_URL")
+			}
+			headers, err := parseHeaderList(os.Getenv("MMA_HTTP_SINK_HEADERS"))
+			if err != nil {
+				return nil, err
+			}
+			batchSize := 100
+			if env := os.Getenv("MMA_HTTP_SINK_BATCH_SIZE"); env != "" {
+				batchSize, err = strconv.Atoi(env)
+				if err != nil || batchSize <= 0 {
+					return nil, fmt.Errorf("invalid MMA_HTTP_SINK_BATCH_SIZE %q", env)
+				}
+			}
+			sinks = append(sinks, newHTTPSink(url, headers, os.Getenv("MMA_HTTP_SINK_TOKEN"), batchSize))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown sink %q, expected file, http, ndjson, stdout, csv, parquet, sqlite or postgres", name)
+		}
+	}
+	return sinks, nil
+}
+
+// writeToSinks hands the fighters to every sink, carrying on past any that fail
+func writeToSinks(sinks []Sink, fighters []FighterStats) {
+	for _, sink := range sinks {
+		if err := sink.Write(fighters); err != nil {
+			log.Printf("Error writing data to %s: %v", sink.Name(), err)
+		} else {
+			progressf("Data successfully written to %s\n", sink.Name())
+		}
+	}
+}
+
+// Helper function to parse a "Name=Value,Name=Value" header list
+func parseHeaderList(list string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected Name=Value", pair)
+		}
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return headers, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestHTTPSink posts to url without waiting long between attempts
+func newTestHTTPSink(url string, batchSize int) *httpSink {
+	sink := newHTTPSink(url, map[string]string{"X-Source": "mma-data-scraper"}, "secret-token", batchSize)
+	sink.BaseDelay = time.Millisecond
+	sink.MaxDelay = time.Millisecond
+	return sink
+}
+
+func testFighters(lastNames ...string) []FighterStats {
+	var fighters []FighterStats
+	for _, lastName := range lastNames {
+		fighters = append(fighters, FighterStats{FirstName: "Test", LastName: lastName})
+	}
+	return fighters
+}
+
+func TestHTTPSinkSendsBatches(t *testing.T) {
+	server, attempts := newTestWebhook(t)
+	sink := newTestHTTPSink(server.URL, 2)
+	if err := sink.Write(testFighters("One", "Two", "Three", "Four", "Five")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := attempts()
+	if len(got) != 3 {
+		t.Fatalf("%d requests, want 3", len(got))
+	}
+	keys := make(map[string]bool)
+	for i, attempt := range got {
+		var batch []FighterStats
+		if err := json.Unmarshal(attempt.Body, &batch); err != nil {
+			t.Fatal(err)
+		}
+		if want := []int{2, 2, 1}[i]; len(batch) != want {
+			t.Errorf("batch %d has %d fighters, want %d", i+1, len(batch), want)
+		}
+		if got := attempt.Header.Get("Authorization"); got != "Bearer secret-token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := attempt.Header.Get("X-Source"); got != "mma-data-scraper" {
+			t.Errorf("X-Source = %q", got)
+		}
+		if got := attempt.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		keys[attempt.Header.Get("Idempotency-Key")] = true
+	}
+	if len(keys) != 3 || keys[""] {
+		t.Errorf("Idempotency-Keys %v, want one per batch", keys)
+	}
+}
+
+func TestHTTPSinkRetriesServerErrors(t *testing.T) {
+	server, attempts := newTestWebhook(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	sink := newTestHTTPSink(server.URL, 100)
+	if err := sink.Write(testFighters("One")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := attempts()
+	if len(got) != 3 {
+		t.Fatalf("%d requests, want 3", len(got))
+	}
+	for i, attempt := range got[1:] {
+		if attempt.Header.Get("Idempotency-Key") != got[0].Header.Get("Idempotency-Key") {
+			t.Errorf("attempt %d has Idempotency-Key %q, the first had %q", i+2, attempt.Header.Get("Idempotency-Key"), got[0].Header.Get("Idempotency-Key"))
+		}
+		if string(attempt.Body) != string(got[0].Body) {
+			t.Errorf("attempt %d has a different body", i+2)
+		}
+	}
+}
+
+func TestHTTPSinkGivesUp(t *testing.T) {
+	// Server errors are retried up to MaxAttempts
+	server, attempts := newTestWebhook(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	sink := newTestHTTPSink(server.URL, 100)
+	sink.MaxAttempts = 3
+	if err := sink.Write(testFighters("One")); err == nil {
+		t.Error("no error after 3 failed attempts")
+	}
+	if got := attempts(); len(got) != 3 {
+		t.Errorf("%d requests, want 3", len(got))
+	}
+
+	// Client errors aren't retried, and the next batch is still sent
+	server, attempts = newTestWebhook(t, http.StatusBadRequest)
+	sink = newTestHTTPSink(server.URL, 1)
+	err := sink.Write(testFighters("One", "Two"))
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 batches rejected") {
+		t.Errorf("error %v, want 1 of 2 batches rejected", err)
+	}
+	if got := attempts(); len(got) != 2 {
+		t.Errorf("%d requests, want 2", len(got))
+	}
+}
+
+func TestHTTPSinkWaitsForRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	sink := newTestHTTPSink(server.URL, 100)
+	if err := sink.Write(testFighters("One")); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(times) != 2 {
+		t.Fatalf("%d requests, want 2", len(times))
+	}
+	if waited := times[1].Sub(times[0]); waited < time.Second {
+		t.Errorf("retried after %s, want at least the 1s of Retry-After", waited)
+	}
+}
+
+// The same batch gets the same key in every run, so a receiver can drop a batch it already stored
+func TestHTTPSinkIdempotencyKeyIsStable(t *testing.T) {
+	server, attempts := newTestWebhook(t)
+	sink := newTestHTTPSink(server.URL, 100)
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(testFighters("One", "Two")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Write(testFighters("One", "Three")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := attempts()
+	if len(got) != 3 {
+		t.Fatalf("%d requests, want 3", len(got))
+	}
+	if got[0].Header.Get("Idempotency-Key") != got[1].Header.Get("Idempotency-Key") {
+		t.Errorf("the same batch got keys %q and %q", got[0].Header.Get("Idempotency-Key"), got[1].Header.Get("Idempotency-Key"))
+	}
+	if got[0].Header.Get("Idempotency-Key") == got[2].Header.Get("Idempotency-Key") {
+		t.Errorf("different batches share the key %q", got[0].Header.Get("Idempotency-Key"))
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlDialect covers the differences between the SQL databases the sinks write to. Queries are
+// written with ? placeholders and rebound for the database they run against.
+type sqlDialect int
+
+const (
+	dialectSQLite sqlDialect = iota
+	dialectPostgres
+)
+
+// rebind rewrites ? placeholders into the dialect's own style
+func (d sqlDialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlMigrations are applied in order by migrateSQL, and each only once. Both SQL sinks share
+// them; the column types that differ between the databases are written as {{placeholders}}
+// that each dialect fills in. Never edit a migration that has been released; add a new one
+// instead.
+var sqlMigrations = []string{
+	`CREATE TABLE fighters (
+		id                TEXT PRIMARY KEY,
+		first_name        TEXT NOT NULL,
+		last_name         TEXT NOT NULL,
+		height_and_weight TEXT NOT NULL,
+		birthdate         TEXT NOT NULL,
+		team              TEXT NOT NULL,
+		nickname          TEXT NOT NULL,
+		stance            TEXT NOT NULL,
+		win_loss_record   TEXT NOT NULL,
+		tko_record        TEXT NOT NULL,
+		sub_record        TEXT NOT NULL,
+		updated_at        {{timestamp}} NOT NULL
+	);
+
+	CREATE TABLE events (
+		id   {{serial}} PRIMARY KEY,
+		name TEXT NOT NULL,
+		date TEXT NOT NULL,
+		UNIQUE (name, date)
+	);
+
+	CREATE TABLE fights (
+		fighter_id TEXT NOT NULL REFERENCES fighters (id) ON DELETE CASCADE,
+		position   INTEGER NOT NULL,
+		event_id   {{bigint}} REFERENCES events (id),
+		date       TEXT NOT NULL,
+		opponent   TEXT NOT NULL,
+		result     TEXT NOT NULL,
+		decision   TEXT NOT NULL,
+		rnd        TEXT NOT NULL,
+		time       TEXT NOT NULL,
+		PRIMARY KEY (fighter_id, position)
+	);
+
+	CREATE TABLE striking (
+		fighter_id   TEXT NOT NULL REFERENCES fighters (id) ON DELETE CASCADE,
+		position     INTEGER NOT NULL,
+		event_id     {{bigint}} REFERENCES events (id),
+		date         TEXT NOT NULL,
+		opponent     TEXT NOT NULL,
+		result       TEXT NOT NULL,
+		sdbl_a       TEXT NOT NULL,
+		sdhl_a       TEXT NOT NULL,
+		sdll_a       TEXT NOT NULL,
+		tsl          TEXT NOT NULL,
+		tsa          TEXT NOT NULL,
+		ssl          TEXT NOT NULL,
+		ssa          TEXT NOT NULL,
+		tsl_tsa      TEXT NOT NULL,
+		kd           TEXT NOT NULL,
+		percent_body TEXT NOT NULL,
+		percent_head TEXT NOT NULL,
+		percent_leg  TEXT NOT NULL,
+		PRIMARY KEY (fighter_id, position)
+	);
+
+	CREATE TABLE clinch (
+		fighter_id TEXT NOT NULL REFERENCES fighters (id) ON DELETE CASCADE,
+		position   INTEGER NOT NULL,
+		event_id   {{bigint}} REFERENCES events (id),
+		date       TEXT NOT NULL,
+		opponent   TEXT NOT NULL,
+		result     TEXT NOT NULL,
+		scbl       TEXT NOT NULL,
+		scba       TEXT NOT NULL,
+		schl       TEXT NOT NULL,
+		scha       TEXT NOT NULL,
+		scll       TEXT NOT NULL,
+		scla       TEXT NOT NULL,
+		rv         TEXT NOT NULL,
+		sr         TEXT NOT NULL,
+		tdl        TEXT NOT NULL,
+		tda        TEXT NOT NULL,
+		tds        TEXT NOT NULL,
+		tk_acc     TEXT NOT NULL,
+		PRIMARY KEY (fighter_id, position)
+	);
+
+	CREATE TABLE ground (
+		fighter_id TEXT NOT NULL REFERENCES fighters (id) ON DELETE CASCADE,
+		position   INTEGER NOT NULL,
+		event_id   {{bigint}} REFERENCES events (id),
+		date       TEXT NOT NULL,
+		opponent   TEXT NOT NULL,
+		result     TEXT NOT NULL,
+		sgbl       TEXT NOT NULL,
+		sgba       TEXT NOT NULL,
+		sghl       TEXT NOT NULL,
+		sgha       TEXT NOT NULL,
+		sgll       TEXT NOT NULL,
+		sgla       TEXT NOT NULL,
+		ad         TEXT NOT NULL,
+		adtb       TEXT NOT NULL,
+		adhg       TEXT NOT NULL,
+		adtm       TEXT NOT NULL,
+		adts       TEXT NOT NULL,
+		sm         TEXT NOT NULL,
+		PRIMARY KEY (fighter_id, position)
+	);
+
+	CREATE INDEX fights_event_id ON fights (event_id);
+	CREATE INDEX fighters_name ON fighters (last_name, first_name);`,
+
+	// Where and when each fighter was scraped. Source URLs are stored as a JSON array.
+	`ALTER TABLE fighters ADD COLUMN scraped_at {{timestamp}};
+	ALTER TABLE fighters ADD COLUMN source_urls TEXT NOT NULL DEFAULT '[]';`,
+}
+
+// sqlTypes fill in the column type placeholders of the migrations for each dialect
+var sqlTypes = map[sqlDialect]*strings.Replacer{
+	dialectSQLite:   strings.NewReplacer("{{serial}}", "INTEGER", "{{bigint}}", "INTEGER", "{{timestamp}}", "TEXT"),
+	dialectPostgres: strings.NewReplacer("{{serial}}", "BIGSERIAL", "{{bigint}}", "BIGINT", "{{timestamp}}", "TIMESTAMPTZ"),
+}
+
+// migrations returns the migrations written in the dialect's column types
+func (d sqlDialect) migrations() []string {
+	migrations := make([]string, len(sqlMigrations))
+	for i, migration := range sqlMigrations {
+		migrations[i] = sqlTypes[d].Replace(migration)
+	}
+	return migrations
+}
+
+// tableExists reports whether the database has a table with the given name
+func (d sqlDialect) tableExists(db *sql.DB, table string) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if d == dialectPostgres {
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	var count int
+	err := db.QueryRow(d.rebind(query), table).Scan(&count)
+	return count > 0, err
+}
+
+// schemaVersion returns the latest migration applied to the database, or 0 for a new database.
+// It only reads, so a sink can check the schema without changing it.
+func schemaVersion(db *sql.DB, dialect sqlDialect) (int, error) {
+	exists, err := dialect.tableExists(db, "schema_migrations")
+	if err != nil || !exists {
+		return 0, err
+	}
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	return current, err
+}
+
+// migrateSQL applies the migrations the database hasn't seen yet, each in its own transaction
+func migrateSQL(db *sql.DB, dialect sqlDialect) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	migrations := dialect.migrations()
+
+	for version := current + 1; version <= len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version-1]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", version, err)
+		}
+		_, err = tx.Exec(dialect.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), version, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertFighterSQL replaces everything stored for one fighter in a single transaction
+func upsertFighterSQL(db *sql.DB, dialect sqlDialect, fighter *FighterStats) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id := fighterID(fighter)
+	var scrapedAt interface{}
+	if !fighter.ScrapedAt.IsZero() {
+		scrapedAt = fighter.ScrapedAt.UTC().Format(time.RFC3339Nano)
+	}
+	sourceURLs, err := json.Marshal(append([]string{}, fighter.SourceURLs...))
+	if err != nil {
+		return err
+	}
+	columns, values := stringColumns(*fighter, "id")
+	columns = append([]string{"id"}, append(columns, "updated_at", "scraped_at", "source_urls")...)
+	values = append([]interface{}{id}, append(values, time.Now().UTC().Format(time.RFC3339), scrapedAt, string(sourceURLs))...)
+
+	var updates []string
+	for _, column := range columns[1:] {
+		updates = append(updates, column+" = excluded."+column)
+	}
+	query := fmt.Sprintf("INSERT INTO fighters (%s) VALUES (%s) ON CONFLICT (id) DO UPDATE SET %s",
+		strings.Join(columns, ", "), sqlPlaceholders(len(columns)), strings.Join(updates, ", "))
+	if _, err := tx.Exec(dialect.rebind(query), values...); err != nil {
+		return err
+	}
+
+	// The per-fight rows have no stable key of their own, so they are replaced wholesale
+	for _, table := range []string{"fights", "striking", "clinch", "ground"} {
+		if _, err := tx.Exec(dialect.rebind("DELETE FROM "+table+" WHERE fighter_id = ?"), id); err != nil {
+			return err
+		}
+	}
+
+	for i, fight := range fighter.Fights {
+		if err := insertFightRowSQL(tx, dialect, "fights", id, i, fight.Event, fight.Date, fight); err != nil {
+			return err
+		}
+	}
+	for i, stats := range fighter.StrikingStats {
+		if err := insertFightRowSQL(tx, dialect, "striking", id, i, stats.Event, stats.Date, stats); err != nil {
+			return err
+		}
+	}
+	for i, stats := range fighter.ClinchStats {
+		if err := insertFightRowSQL(tx, dialect, "clinch", id, i, stats.Event, stats.Date, stats); err != nil {
+			return err
+		}
+	}
+	for i, stats := range fighter.GroundStats {
+		if err := insertFightRowSQL(tx, dialect, "ground", id, i, stats.Event, stats.Date, stats); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertFightRowSQL inserts one row of a per-fight table, linking it to its event
+func insertFightRowSQL(tx *sql.Tx, dialect sqlDialect, table, fighterID string, position int, event, date string, row interface{}) error {
+	eventID, err := upsertEventSQL(tx, dialect, event, date)
+	if err != nil {
+		return err
+	}
+
+	columns, values := stringColumns(row, "event")
+	columns = append([]string{"fighter_id", "position", "event_id"}, columns...)
+	values = append([]interface{}{fighterID, position, eventID}, values...)
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), sqlPlaceholders(len(columns)))
+	_, err = tx.Exec(dialect.rebind(query), values...)
+	return err
+}
+
+// upsertEventSQL returns the ID of the event with the given name and date, creating it if
+// needed. Rows without an event name get a NULL event.
+func upsertEventSQL(tx *sql.Tx, dialect sqlDialect, name, date string) (interface{}, error) {
+	if name == "" {
+		return nil, nil
+	}
+	_, err := tx.Exec(dialect.rebind(`INSERT INTO events (name, date) VALUES (?, ?) ON CONFLICT (name, date) DO NOTHING`), name, date)
+	if err != nil {
+		return nil, err
+	}
+	var id int64
+	err = tx.QueryRow(dialect.rebind(`SELECT id FROM events WHERE name = ? AND date = ?`), name, date).Scan(&id)
+	return id, err
+}
+
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// loadFightersSQL reads every fighter back out of a database written by the SQL sinks
+func loadFightersSQL(db *sql.DB) ([]FighterStats, error) {
+	columns, _ := stringColumns(FighterStats{}, "id")
+	rows, err := db.Query("SELECT id, " + strings.Join(columns, ", ") + ", scraped_at, source_urls FROM fighters ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fighters []FighterStats
+	index := make(map[string]int)
+	for rows.Next() {
+		values := make([]string, len(columns)+1)
+		pointers := make([]interface{}, len(values), len(values)+2)
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		var scrapedAt sql.NullString
+		var sourceURLs string
+		if err := rows.Scan(append(pointers, &scrapedAt, &sourceURLs)...); err != nil {
+			return nil, err
+		}
+		fighter := FighterStats{ID: values[0]}
+		setStringColumns(&fighter, columns, values[1:])
+		if scrapedAt.Valid {
+			t, err := time.Parse(time.RFC3339Nano, scrapedAt.String)
+			if err != nil {
+				return nil, fmt.Errorf("fighter %s: invalid scraped_at %q", fighter.ID, scrapedAt.String)
+			}
+			fighter.ScrapedAt = t.UTC()
+		}
+		if err := json.Unmarshal([]byte(sourceURLs), &fighter.SourceURLs); err != nil {
+			return nil, fmt.Errorf("fighter %s: invalid source_urls: %v", fighter.ID, err)
+		}
+		if len(fighter.SourceURLs) == 0 {
+			fighter.SourceURLs = nil
+		}
+		index[fighter.ID] = len(fighters)
+		fighters = append(fighters, fighter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadFightRowsSQL(db, "fights", Fight{}, func(id string, names, values []string) {
+		if i, ok := index[id]; ok {
+			var fight Fight
+			setStringColumns(&fight, names, values)
+			fighters[i].Fights = append(fighters[i].Fights, fight)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = loadFightRowsSQL(db, "striking", StrikingStats{}, func(id string, names, values []string) {
+		if i, ok := index[id]; ok {
+			var stats StrikingStats
+			setStringColumns(&stats, names, values)
+			fighters[i].StrikingStats = append(fighters[i].StrikingStats, stats)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = loadFightRowsSQL(db, "clinch", ClinchStats{}, func(id string, names, values []string) {
+		if i, ok := index[id]; ok {
+			var stats ClinchStats
+			setStringColumns(&stats, names, values)
+			fighters[i].ClinchStats = append(fighters[i].ClinchStats, stats)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = loadFightRowsSQL(db, "ground", GroundStats{}, func(id string, names, values []string) {
+		if i, ok := index[id]; ok {
+			var stats GroundStats
+			setStringColumns(&stats, names, values)
+			fighters[i].GroundStats = append(fighters[i].GroundStats, stats)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fighters, nil
+}
+
+// loadFightRowsSQL reads a per-fight table in position order, with the event name joined
+// back in, and hands each row to add
+func loadFightRowsSQL(db *sql.DB, table string, row interface{}, add func(fighterID string, names, values []string)) error {
+	columns, _ := stringColumns(row, "event")
+	query := fmt.Sprintf("SELECT t.fighter_id, COALESCE(e.name, ''), t.%s FROM %s t LEFT JOIN events e ON e.id = t.event_id ORDER BY t.fighter_id, t.position",
+		strings.Join(columns, ", t."), table)
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	names := append([]string{"event"}, columns...)
+	for rows.Next() {
+		values, err := scanStrings(rows, len(columns)+2)
+		if err != nil {
+			return err
+		}
+		add(values[0], names, values[1:])
+	}
+	return rows.Err()
+}
+
+// Helper function to scan a row of n text columns
+func scanStrings(rows *sql.Rows, n int) ([]string, error) {
+	values := make([]string, n)
+	pointers := make([]interface{}, n)
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	return values, rows.Scan(pointers...)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	query := "INSERT INTO events (name, date) VALUES (?, ?)"
+	if got := dialectSQLite.rebind(query); got != query {
+		t.Errorf("sqlite rebind = %q", got)
+	}
+	if got, want := dialectPostgres.rebind(query), "INSERT INTO events (name, date) VALUES ($1, $2)"; got != want {
+		t.Errorf("postgres rebind = %q, want %q", got, want)
+	}
+}
+
+func TestMigrationsFillInColumnTypes(t *testing.T) {
+	for dialect, want := range map[sqlDialect]string{dialectSQLite: "id   INTEGER PRIMARY KEY", dialectPostgres: "id   BIGSERIAL PRIMARY KEY"} {
+		migrations := dialect.migrations()
+		if len(migrations) != len(sqlMigrations) {
+			t.Fatalf("%d migrations, want %d", len(migrations), len(sqlMigrations))
+		}
+		for i, migration := range migrations {
+			if strings.Contains(migration, "{{") {
+				t.Errorf("dialect %d migration %d has a placeholder left", dialect, i+1)
+			}
+		}
+		if !strings.Contains(migrations[0], want) {
+			t.Errorf("dialect %d migration 1 doesn't contain %q", dialect, want)
+		}
+	}
+}
+
+// sqlTestFighters are the test snapshot's fighters, with a row in every per-fight table
+func sqlTestFighters() []FighterStats {
+	fighters := testSnapshot().Fighters
+	fighters[0].ScrapedAt = time.Date(2024, 7, 11, 3, 15, 0, 123456000, time.UTC)
+	fighters[0].SourceURLs = []string{"https://www.espn.com/mma/fighter/stats/_/id/3022677/conor-mcgregor"}
+	fighters[0].StrikingStats = []StrikingStats{{Date: "Jul 10, 2021", Opponent: "Dustin Poirier", Event: "UFC 264", Result: "L", TSL: "16", TSA: "41"}}
+	fighters[0].ClinchStats = []ClinchStats{{Date: "Jul 10, 2021", Opponent: "Dustin Poirier", Event: "UFC 264", Result: "L", SCBL: "2"}}
+	fighters[0].GroundStats = []GroundStats{{Date: "Jul 10, 2021", Opponent: "Dustin Poirier", Event: "UFC 264", Result: "L", SGHA: "1"}}
+	return fighters
+}
+
+// checkStoredFighters compares the fighters read back from db with the ones written
+func checkStoredFighters(t *testing.T, db *sql.DB, want []FighterStats) {
+	t.Helper()
+	got, err := loadFightersSQL(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append([]FighterStats(nil), want...)
+	sort.Slice(want, func(i, j int) bool { return want[i].ID < want[j].ID })
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stored fighters\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestSQLiteSinkRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fighters.db")
+	sink := &sqliteSink{Path: path}
+	fighters := sqlTestFighters()
+	if err := sink.Write(fighters); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second run replaces the fighters' rows instead of adding to them
+	fighters[1].WinLossRecord = "30-9-0"
+	fighters[1].Fights = append(fighters[1].Fights, Fight{Date: "Jul 29, 2023", Opponent: "Justin Gaethje", Event: "UFC 291", Result: "L", Decision: "KO/TKO", Rnd: "2", Time: "1:00"})
+	if err := sink.Write(fighters); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkStoredFighters(t, db, fighters)
+
+	var events int
+	if err := db.QueryRow("SELECT COUNT(*) FROM events").Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if events != 2 {
+		t.Errorf("%d events, want 2", events)
+	}
+}
+
+func TestSchemaVersionOnlyReads(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "fighters.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	version, err := schemaVersion(db, dialectSQLite)
+	if err != nil || version != 0 {
+		t.Fatalf("schemaVersion of a new database = %d, %v, want 0", version, err)
+	}
+	if exists, err := dialectSQLite.tableExists(db, "schema_migrations"); err != nil || exists {
+		t.Errorf("schemaVersion created schema_migrations (%v)", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := migrateSQL(db, dialectSQLite); err != nil {
+			t.Fatal(err)
+		}
+	}
+	version, err = schemaVersion(db, dialectSQLite)
+	if err != nil || version != len(sqlMigrations) {
+		t.Errorf("schemaVersion after migrating = %d, %v, want %d", version, err, len(sqlMigrations))
+	}
+}
+
+func TestMigrationAddsProvenanceColumns(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "fighters.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A fighter stored before the provenance columns existed loads without them
+	if _, err := db.Exec(dialectSQLite.migrations()[0]); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL);
+		INSERT INTO schema_migrations VALUES (1, '2024-07-11T03:15:00Z');
+		INSERT INTO fighters VALUES ('3022677', 'Conor', 'McGregor', '', '', '', '', '', '22-6-0', '', '', '2024-07-11T03:15:00Z')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateSQL(db, dialectSQLite); err != nil {
+		t.Fatal(err)
+	}
+	checkStoredFighters(t, db, []FighterStats{{ID: "3022677", FirstName: "Conor", LastName: "McGregor", WinLossRecord: "22-6-0"}})
+}
+
+// The PostgreSQL sink is tested against the empty database in MMA_TEST_POSTGRES_URL, when set
+func TestPostgresSink(t *testing.T) {
+	url := os.Getenv("MMA_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("MMA_TEST_POSTGRES_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Writing to a database that hasn't been migrated fails without touching its schema
+	sink := &postgresSink{URL: url}
+	fighters := sqlTestFighters()
+	if err := sink.Write(fighters); err == nil {
+		t.Fatal("no error writing to a database that hasn't been migrated")
+	}
+	if exists, err := dialectPostgres.tableExists(db, "schema_migrations"); err != nil || exists {
+		t.Fatalf("the sink created schema_migrations (%v)", err)
+	}
+
+	if err := sink.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(fighters); err != nil {
+		t.Fatal(err)
+	}
+	checkStoredFighters(t, db, fighters)
+}
+
+func TestLoadSQLiteSnapshotReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fighters.db")
+	fighters := sqlTestFighters()
+	if err := (&sqliteSink{Path: path}).Write(fighters); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := loadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Fighters) != len(fighters) {
+		t.Errorf("%d fighters, want %d", len(snapshot.Fighters), len(fighters))
+	}
+
+	db, err := sql.Open("sqlite3", readOnlySQLite(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("DELETE FROM fighters"); err == nil {
+		t.Error("deleted fighters from a database opened read-only")
+	}
+}
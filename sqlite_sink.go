@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const defaultSQLitePath = "fighters.db"
+
+// sqliteSink upserts the fighters into a SQLite database with one table per kind of record.
+// Fighters are keyed by their ESPN ID, so fighters missing from a run keep their old data.
+type sqliteSink struct {
+	Path string
+}
+
+func (s *sqliteSink) Name() string {
+	return "sqlite " + s.Path
+}
+
+func (s *sqliteSink) Write(fighters []FighterStats) error {
+	db, err := openSQLite(s.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for i := range fighters {
+		if err := upsertFighterSQL(db, dialectSQLite, &fighters[i]); err != nil {
+			return fmt.Errorf("fighter %s: %v", fighterID(&fighters[i]), err)
+		}
+	}
+	return nil
+}
+
+func (s *sqliteSink) Migrate() error {
+	db, err := openSQLite(s.Path)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// openSQLite opens the database with foreign keys enforced and brings its schema up to date
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateSQL(db, dialectSQLite); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
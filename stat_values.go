@@ -0,0 +1,102 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The scraped values are kept as ESPN displays them. These helpers turn them into typed values
+// for outputs that want numbers and dates; each returns false when the value is missing ("-" or
+// empty) or doesn't parse.
+
+var (
+	heightPattern = regexp.MustCompile(`(\d+)'\s*(\d+)"`)
+	weightPattern = regexp.MustCompile(`([\d.]+)\s*lbs`)
+)
+
+// Helper function to parse a count such as "12"
+func parseStatInt(value string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	return n, err == nil
+}
+
+// Helper function to parse a percentage such as "48%" or a plain number such as "0.5"
+func parseStatFloat(value string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	return f, err == nil
+}
+
+// Helper function to parse a landed/attempted pair such as "5/12"
+func parseLandedAttempted(value string) (int, int, bool) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	landed, ok := parseStatInt(parts[0])
+	if !ok {
+		return 0, 0, false
+	}
+	attempted, ok := parseStatInt(parts[1])
+	return landed, attempted, ok
+}
+
+// Helper function to parse a dash-separated record such as "22-6-0" or "9-2"
+func parseRecord(value string) ([]int, bool) {
+	var record []int
+	for _, part := range strings.Split(strings.TrimSpace(value), "-") {
+		n, ok := parseStatInt(part)
+		if !ok {
+			return nil, false
+		}
+		record = append(record, n)
+	}
+	return record, true
+}
+
+// Helper function to parse a fight date such as "Jul 11, 2021", or a birthdate such as
+// "3/14/1989 (35)"
+func parseStatDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, " ("); i >= 0 {
+		value = value[:i]
+	}
+	for _, layout := range []string{"Jan 2, 2006", "1/2/2006", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Helper function to parse the time of a stoppage such as "4:12" into seconds
+func parseFightTime(value string) (int, bool) {
+	parts := strings.SplitN(strings.TrimSpace(value), ":", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	minutes, ok := parseStatInt(parts[0])
+	if !ok {
+		return 0, false
+	}
+	seconds, ok := parseStatInt(parts[1])
+	return minutes*60 + seconds, ok
+}
+
+// Helper function to parse a height and weight such as `5' 9", 155 lbs` into inches and pounds
+func parseHeightAndWeight(value string) (int, bool, float64, bool) {
+	var inches int
+	var pounds float64
+	hasHeight, hasWeight := false, false
+	if m := heightPattern.FindStringSubmatch(value); m != nil {
+		feet, _ := strconv.Atoi(m[1])
+		rest, _ := strconv.Atoi(m[2])
+		inches, hasHeight = feet*12+rest, true
+	}
+	if m := weightPattern.FindStringSubmatch(value); m != nil {
+		pounds, _ = strconv.ParseFloat(m[1], 64)
+		hasWeight = true
+	}
+	return inches, hasHeight, pounds, hasWeight
+}
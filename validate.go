@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// runValidateCommand checks a snapshot and exits with an error if it has problems. Data quality
+// issues are listed too, and only fail the check with -strict.
+func runValidateCommand(args []string) error {
+	flags, v := newCommandFlags("validate", "<snapshot>")
+	reportPath := flags.String("report", "", "also write the quality issues to this file as JSON")
+	strict := flags.Bool("strict", false, "fail on data quality issues as well as problems")
+	if err := parseCommandFlags(flags, v, args, 1); err != nil {
+		return err
+	}
+
+	snapshot, err := loadSnapshot(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", flags.Arg(0), err)
+	}
+
+	problems := validateSnapshot(snapshot)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	var issues []qualityIssue
+	for i := range snapshot.Fighters {
+		for _, issue := range checkFighter(&snapshot.Fighters[i]) {
+			// Already a problem above
+			if issue.Rule != ruleName {
+				issues = append(issues, issue)
+			}
+		}
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if *reportPath != "" {
+		report := newQualityReport(snapshot.RunID, len(snapshot.Fighters), issues)
+		if err := writeQualityReport(*reportPath, report); err != nil {
+			return fmt.Errorf("writing %s: %v", *reportPath, err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %d problems, %d quality issues", flags.Arg(0), len(problems), len(issues))
+	}
+	if *strict && len(issues) > 0 {
+		return fmt.Errorf("%s: %d quality issues", flags.Arg(0), len(issues))
+	}
+	progressf("%s: %d fighters, no problems, %d quality issues\n", flags.Arg(0), len(snapshot.Fighters), len(issues))
+	return nil
+}
+
+// validateSnapshot checks that a snapshot is well formed, returning one message per problem
+func validateSnapshot(snapshot *outputEnvelope) []string {
+	var problems []string
+	if snapshot.SchemaVersion > outputSchemaVersion {
+		problems = append(problems, fmt.Sprintf("schema version %d is newer than this scraper's %d", snapshot.SchemaVersion, outputSchemaVersion))
+	}
+
+	// Files with an envelope say how many rows they hold
+	if snapshot.SchemaVersion >= 2 {
+		counts := newOutputEnvelope(&runInfo{}, snapshot.Fighters).Counts
+		if counts != snapshot.Counts {
+			problems = append(problems, fmt.Sprintf("counts %+v don't match the data, which has %+v", snapshot.Counts, counts))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range snapshot.Fighters {
+		fighter := &snapshot.Fighters[i]
+		id := fighterID(fighter)
+		name := fmt.Sprintf("fighter %d (%s)", i, id)
+		if fighter.FirstName == "" || fighter.LastName == "" {
+			problems = append(problems, name+": missing first or last name")
+		}
+		if seen[id] {
+			problems = append(problems, name+": duplicate fighter")
+		}
+		seen[id] = true
+
+		for j, fight := range fighter.Fights {
+			if fight.Date == "" || fight.Opponent == "" {
+				problems = append(problems, fmt.Sprintf("%s: fight %d has no date or opponent", name, j))
+			}
+		}
+		for j, stats := range fighter.StrikingStats {
+			if stats.Date == "" || stats.Opponent == "" {
+				problems = append(problems, fmt.Sprintf("%s: striking row %d has no date or opponent", name, j))
+			}
+		}
+		for j, stats := range fighter.ClinchStats {
+			if stats.Date == "" || stats.Opponent == "" {
+				problems = append(problems, fmt.Sprintf("%s: clinch row %d has no date or opponent", name, j))
+			}
+		}
+		for j, stats := range fighter.GroundStats {
+			if stats.Date == "" || stats.Opponent == "" {
+				problems = append(problems, fmt.Sprintf("%s: ground row %d has no date or opponent", name, j))
+			}
+		}
+	}
+	return problems
+}
+
+const defaultQualityReportFile = "quality_report.json"
+
+// The data quality rules. Unlike the problems validateSnapshot finds, a violation doesn't make
+// a snapshot unusable: it is usually a value ESPN got wrong, or a page that didn't parse.
+const (
+	ruleName            = "name"             // A fighter without a first or last name, left out of the output
+	ruleLandedAttempted = "landed-attempted" // More strikes or takedowns landed than attempted
+	rulePercentages     = "percentages"      // Body, head and leg percentages that don't add up to 100
+	ruleDate            = "date"             // A date that doesn't parse
+	ruleRecord          = "record"           // A record that disagrees with the fight history
+	ruleEmptyTable      = "empty-table"      // A table whose header is on the page but has no rows
+	ruleParse           = "parse"            // A fighter page that failed to parse, kept in the quarantine directory
+)
+
+// percentageTolerance is how far from 100 the percentages may add up to, for rounding
+const percentageTolerance = 2
+
+// qualityIssue is one violation of a data quality rule
+type qualityIssue struct {
+	FighterID string `json:"fighter_id"`
+	Fighter   string `json:"fighter"`
+	Rule      string `json:"rule"`
+	Message   string `json:"message"`
+	SourceURL string `json:"source_url,omitempty"` // The page the value came from
+}
+
+func (issue qualityIssue) String() string {
+	s := fmt.Sprintf("fighter %s (%s): %s: %s", issue.FighterID, issue.Fighter, issue.Rule, issue.Message)
+	if issue.SourceURL != "" {
+		s += " (" + issue.SourceURL + ")"
+	}
+	return s
+}
+
+// qualityReport lists the quality issues of a run's fighters
+type qualityReport struct {
+	RunID    string         `json:"run_id,omitempty"`
+	Fighters int            `json:"fighters"`
+	Rules    map[string]int `json:"rules"` // Issues per rule
+	Issues   []qualityIssue `json:"issues"`
+}
+
+func newQualityReport(runID string, fighters int, issues []qualityIssue) qualityReport {
+	report := qualityReport{RunID: runID, Fighters: fighters, Rules: make(map[string]int), Issues: issues}
+	if report.Issues == nil {
+		report.Issues = []qualityIssue{}
+	}
+	for _, issue := range issues {
+		report.Rules[issue.Rule]++
+	}
+	return report
+}
+
+// Helper function to write the quality report as JSON
+func writeQualityReport(path string, report qualityReport) error {
+	jsonData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, jsonData, 0644)
+}
+
+// qualityReportPath is where a crawl writes its quality report, MMA_QUALITY_REPORT or
+// quality_report.json
+func qualityReportPath() string {
+	if path := os.Getenv("MMA_QUALITY_REPORT"); path != "" {
+		return path
+	}
+	return defaultQualityReportFile
+}
+
+// checkFighter applies the data quality rules to a fighter's values
+func checkFighter(fighter *FighterStats) []qualityIssue {
+	var issues []qualityIssue
+	add := func(rule, page, format string, args ...interface{}) {
+		issues = append(issues, qualityIssue{
+			FighterID: fighterID(fighter),
+			Fighter:   fighterName(fighter),
+			Rule:      rule,
+			Message:   fmt.Sprintf(format, args...),
+			SourceURL: fighterSourceURL(fighter, page),
+		})
+	}
+
+	if fighter.FirstName == "" || fighter.LastName == "" {
+		add(ruleName, "", "missing first or last name")
+	}
+	if fighter.Birthdate != "" {
+		if _, ok := parseStatDate(fighter.Birthdate); !ok {
+			add(ruleDate, "", "birthdate %q doesn't parse", fighter.Birthdate)
+		}
+	}
+
+	// The fights in the history can't outnumber the wins, losses and draws of the record
+	if fighter.WinLossRecord != "" {
+		record, ok := parseRecord(fighter.WinLossRecord)
+		if !ok {
+			add(ruleRecord, "", "record %q doesn't parse", fighter.WinLossRecord)
+		} else {
+			counted := make(map[string]int)
+			for _, fight := range fighter.Fights {
+				counted[strings.ToUpper(fight.Result)]++
+			}
+			for i, result := range []struct{ code, label string }{{"W", "wins"}, {"L", "losses"}, {"D", "draws"}} {
+				if i < len(record) && counted[result.code] > record[i] {
+					add(ruleRecord, "history", "record %s has %d %s but the history has %d", fighter.WinLossRecord, record[i], result.label, counted[result.code])
+				}
+			}
+			if total := sumInts(record); total > 0 && len(fighter.Fights) == 0 {
+				add(ruleRecord, "history", "record %s but no fights in the history", fighter.WinLossRecord)
+			}
+		}
+	}
+
+	for i, fight := range fighter.Fights {
+		if _, ok := parseStatDate(fight.Date); !ok && fight.Date != "" {
+			add(ruleDate, "history", "fight %d date %q doesn't parse", i, fight.Date)
+		}
+	}
+
+	checkPair := func(table string, row int, field string, landed, attempted int) {
+		if landed > attempted {
+			add(ruleLandedAttempted, "stats", "%s row %d %s landed %d of %d attempted", table, row, field, landed, attempted)
+		}
+	}
+	checkSplit := func(table string, row int, field, value string) {
+		if landed, attempted, ok := parseLandedAttempted(value); ok {
+			checkPair(table, row, field, landed, attempted)
+		}
+	}
+	checkCounts := func(table string, row int, field, landedValue, attemptedValue string) {
+		landed, ok := parseStatInt(landedValue)
+		attempted, ok2 := parseStatInt(attemptedValue)
+		if ok && ok2 {
+			checkPair(table, row, field, landed, attempted)
+		}
+	}
+	checkRowDate := func(table string, row int, date string) {
+		if _, ok := parseStatDate(date); !ok && date != "" {
+			add(ruleDate, "stats", "%s row %d date %q doesn't parse", table, row, date)
+		}
+	}
+
+	for i, stats := range fighter.StrikingStats {
+		checkRowDate("striking", i, stats.Date)
+		checkSplit("striking", i, "sdbl_a", stats.SDblA)
+		checkSplit("striking", i, "sdhl_a", stats.SDhlA)
+		checkSplit("striking", i, "sdll_a", stats.SDllA)
+		checkSplit("striking", i, "tsl_tsa", stats.TSL_TSA)
+		checkCounts("striking", i, "tsl/tsa", stats.TSL, stats.TSA)
+		checkCounts("striking", i, "ssl/ssa", stats.SSL, stats.SSA)
+
+		body, ok1 := parseStatFloat(stats.PercentBody)
+		head, ok2 := parseStatFloat(stats.PercentHead)
+		leg, ok3 := parseStatFloat(stats.PercentLeg)
+		if total := body + head + leg; ok1 && ok2 && ok3 && total > 0 && math.Abs(total-100) > percentageTolerance {
+			add(rulePercentages, "stats", "striking row %d body, head and leg percentages add up to %g", i, total)
+		}
+	}
+	for i, stats := range fighter.ClinchStats {
+		checkRowDate("clinch", i, stats.Date)
+		checkCounts("clinch", i, "scbl/scba", stats.SCBL, stats.SCBA)
+		checkCounts("clinch", i, "schl/scha", stats.SCHL, stats.SCHA)
+		checkCounts("clinch", i, "scll/scla", stats.SCLL, stats.SCLA)
+		checkCounts("clinch", i, "tdl/tda", stats.TDL, stats.TDA)
+	}
+	for i, stats := range fighter.GroundStats {
+		checkRowDate("ground", i, stats.Date)
+		checkCounts("ground", i, "sgbl/sgba", stats.SGBL, stats.SGBA)
+		checkCounts("ground", i, "sghl/sgha", stats.SGHL, stats.SGHA)
+		checkCounts("ground", i, "sgll/sgla", stats.SGLL, stats.SGLA)
+	}
+	return issues
+}
+
+// checkPageTables reports the stats tables whose header is on a page but which came out empty,
+// which is how a change to ESPN's markup shows up
+func checkPageTables(pageURL string, doc *html.Node, stats *FighterStats) []qualityIssue {
+	tables := []struct {
+		name   string
+		header bool
+		rows   int
+	}{
+		{"striking", hasStrikingStatsTable(doc), len(stats.StrikingStats)},
+		{"clinch", hasClinchStatsTable(doc), len(stats.ClinchStats)},
+		{"ground", hasGroundStatsTable(doc), len(stats.GroundStats)},
+		{"fight history", hasFightHistoryTable(doc), len(stats.Fights)},
+	}
+	var issues []qualityIssue
+	for _, table := range tables {
+		if table.header && table.rows == 0 {
+			issues = append(issues, qualityIssue{
+				FighterID: stats.ID,
+				Fighter:   fighterName(stats),
+				Rule:      ruleEmptyTable,
+				Message:   fmt.Sprintf("the %s table has a header but no rows", table.name),
+				SourceURL: pageURL,
+			})
+		}
+	}
+	return issues
+}
+
+// fighterSourceURL returns the fighter's page of a kind, "stats" or "history", or their first
+// page when they have none of that kind or kind is empty
+func fighterSourceURL(fighter *FighterStats, kind string) string {
+	if len(fighter.SourceURLs) == 0 {
+		return ""
+	}
+	for _, sourceURL := range fighter.SourceURLs {
+		if kind != "" && strings.Contains(sourceURL, kind) {
+			return sourceURL
+		}
+	}
+	return fighter.SourceURLs[0]
+}
+
+func sumInts(values []int) int {
+	total := 0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// validTestFighter passes every data quality rule; each test case breaks one
+func validTestFighter() FighterStats {
+	return FighterStats{
+		ID:            "3022677",
+		FirstName:     "Conor",
+		LastName:      "McGregor",
+		Birthdate:     "7/14/1988 (36)",
+		WinLossRecord: "1-1-0",
+		Fights: []Fight{
+			{Date: "Jul 10, 2021", Opponent: "Dustin Poirier", Result: "L"},
+			{Date: "Jan 18, 2020", Opponent: "Donald Cerrone", Result: "W"},
+		},
+		StrikingStats: []StrikingStats{{Date: "Jul 10, 2021", SDblA: "3/5", TSL: "16", TSA: "41", TSL_TSA: "16/41", PercentBody: "20%", PercentHead: "38%", PercentLeg: "42%"}},
+		ClinchStats:   []ClinchStats{{Date: "Jul 10, 2021", SCBL: "2", SCBA: "3", TDL: "0", TDA: "1"}},
+		GroundStats:   []GroundStats{{Date: "Jul 10, 2021", SGHL: "1", SGHA: "1"}},
+		SourceURLs:    []string{"https://www.espn.com/mma/fighter/stats/_/id/3022677", "https://www.espn.com/mma/fighter/history/_/id/3022677"},
+	}
+}
+
+func issueRules(issues []qualityIssue) []string {
+	var rules []string
+	for _, issue := range issues {
+		rules = append(rules, issue.Rule)
+	}
+	return rules
+}
+
+func TestCheckFighter(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(fighter *FighterStats)
+		rules  []string
+	}{
+		{"valid", func(*FighterStats) {}, nil},
+		{"no last name", func(f *FighterStats) { f.LastName = "" }, []string{ruleName}},
+
+		// Landed can't exceed attempted, as a pair or as two counts
+		{"landed equals attempted", func(f *FighterStats) { f.StrikingStats[0].SDblA = "5/5" }, nil},
+		{"landed over attempted", func(f *FighterStats) { f.StrikingStats[0].SDblA = "6/5" }, []string{ruleLandedAttempted}},
+		{"total landed over attempted", func(f *FighterStats) { f.StrikingStats[0].TSL = "42" }, []string{ruleLandedAttempted}},
+		{"takedowns over attempted", func(f *FighterStats) { f.ClinchStats[0].TDL = "2" }, []string{ruleLandedAttempted}},
+		{"ground over attempted", func(f *FighterStats) { f.GroundStats[0].SGHL = "2" }, []string{ruleLandedAttempted}},
+		{"missing counts", func(f *FighterStats) { f.StrikingStats[0].SDblA, f.ClinchStats[0].TDA = "-", "-" }, nil},
+
+		// The percentages may be off from 100 by up to percentageTolerance
+		{"percentages at the tolerance over", func(f *FighterStats) { f.StrikingStats[0].PercentLeg = "44%" }, nil},
+		{"percentages at the tolerance under", func(f *FighterStats) { f.StrikingStats[0].PercentLeg = "40%" }, nil},
+		{"percentages past the tolerance over", func(f *FighterStats) { f.StrikingStats[0].PercentLeg = "44.5%" }, []string{rulePercentages}},
+		{"percentages past the tolerance under", func(f *FighterStats) { f.StrikingStats[0].PercentLeg = "39%" }, []string{rulePercentages}},
+		{"percentages all zero", func(f *FighterStats) {
+			f.StrikingStats[0].PercentBody, f.StrikingStats[0].PercentHead, f.StrikingStats[0].PercentLeg = "0%", "0%", "0%"
+		}, nil},
+		{"percentage missing", func(f *FighterStats) { f.StrikingStats[0].PercentLeg = "-" }, nil},
+
+		// The record against the fight history
+		{"record with more fights than the history", func(f *FighterStats) { f.WinLossRecord = "22-6-0" }, nil},
+		{"record without draws", func(f *FighterStats) { f.WinLossRecord = "1-1" }, nil},
+		{"history with more wins", func(f *FighterStats) { f.WinLossRecord = "0-1-0" }, []string{ruleRecord}},
+		{"history with more wins and losses", func(f *FighterStats) { f.WinLossRecord = "0-0-0" }, []string{ruleRecord, ruleRecord}},
+		{"record without a history", func(f *FighterStats) { f.Fights = nil }, []string{ruleRecord}},
+		{"record that doesn't parse", func(f *FighterStats) { f.WinLossRecord = "1-one-0" }, []string{ruleRecord}},
+
+		// Dates
+		{"ISO fight date", func(f *FighterStats) { f.Fights[0].Date = "2021-07-10" }, nil},
+		{"birthdate that doesn't parse", func(f *FighterStats) { f.Birthdate = "14 July 1988" }, []string{ruleDate}},
+		{"fight date that doesn't parse", func(f *FighterStats) { f.Fights[1].Date = "Jan 18 2020" }, []string{ruleDate}},
+		{"stats date that doesn't parse", func(f *FighterStats) { f.ClinchStats[0].Date = "yesterday" }, []string{ruleDate}},
+		{"empty dates", func(f *FighterStats) { f.Birthdate, f.Fights[0].Date, f.GroundStats[0].Date = "", "", "" }, nil},
+	}
+	for _, test := range tests {
+		fighter := validTestFighter()
+		test.change(&fighter)
+		if got := issueRules(checkFighter(&fighter)); !reflect.DeepEqual(got, test.rules) {
+			t.Errorf("%s: rules %v, want %v", test.name, got, test.rules)
+		}
+	}
+}
+
+// An issue points at the page its value came from
+func TestCheckFighterSourceURL(t *testing.T) {
+	fighter := validTestFighter()
+	fighter.WinLossRecord = "0-1-0"
+	fighter.StrikingStats[0].SDblA = "6/5"
+	issues := checkFighter(&fighter)
+	if len(issues) != 2 {
+		t.Fatalf("issues %v, want 2", issues)
+	}
+	for _, issue := range issues {
+		page := map[string]string{ruleRecord: "history", ruleLandedAttempted: "stats"}[issue.Rule]
+		if !strings.Contains(issue.SourceURL, page) || issue.FighterID != "3022677" || issue.Fighter != "Conor McGregor" {
+			t.Errorf("issue %+v, want one from the %s page", issue, page)
+		}
+	}
+}
+
+func TestCheckPageTables(t *testing.T) {
+	const strikingHeader = `<div class="Table__Title">striking</div>`
+	const historyHeader = `<div class="ResponsiveTable fight-history"></div>`
+	tests := []struct {
+		name, page string
+		stats      FighterStats
+		want       int
+	}{
+		{"no tables", "", FighterStats{}, 0},
+		{"striking table with rows", strikingHeader, FighterStats{StrikingStats: []StrikingStats{{}}}, 0},
+		{"empty striking table", strikingHeader, FighterStats{}, 1},
+		{"empty tables", strikingHeader + `<div class="Table__Title">Clinch</div><div class="Table__Title">Ground</div>`, FighterStats{}, 3},
+		{"empty fight history", historyHeader, FighterStats{}, 1},
+		{"fight history with rows", historyHeader, FighterStats{Fights: []Fight{{}}}, 0},
+	}
+	const pageURL = "https://www.espn.com/mma/fighter/stats/_/id/3022677"
+	for _, test := range tests {
+		doc, err := html.Parse(strings.NewReader("<html><body>" + test.page + "</body></html>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.stats.ID, test.stats.FirstName, test.stats.LastName = "3022677", "Conor", "McGregor"
+		issues := checkPageTables(pageURL, doc, &test.stats)
+		if len(issues) != test.want {
+			t.Errorf("%s: issues %v, want %d", test.name, issues, test.want)
+		}
+		for _, issue := range issues {
+			if issue.Rule != ruleEmptyTable || issue.SourceURL != pageURL || issue.FighterID != "3022677" {
+				t.Errorf("%s: issue %+v", test.name, issue)
+			}
+		}
+	}
+}
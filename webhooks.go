@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Change event types sent to the webhooks
+const (
+	eventFighterDiscovered = "fighter.discovered"
+	eventFighterRemoved    = "fighter.removed"
+	eventFightRecorded     = "fight.recorded"
+	eventRecordChanged     = "record.changed"
+	eventBioChanged        = "bio.changed"
+	eventStatsCorrected    = "stats.corrected"
+)
+
+var allChangeEvents = []string{
+	eventFighterDiscovered,
+	eventFighterRemoved,
+	eventFightRecorded,
+	eventRecordChanged,
+	eventBioChanged,
+	eventStatsCorrected,
+}
+
+// webhookBatchSize is the most events sent in one delivery
+const webhookBatchSize = 100
+
+// changeEvent is one change between the previous run and this one. ID is derived from the
+// change itself, so a receiver can drop an event it has already handled.
+type changeEvent struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	Summary string      `json:"summary"` // One line for people, e.g. in a chat message
+	Data    interface{} `json:"data"`    // A diffFighter, diffFight or diffChange
+}
+
+// webhookDelivery is the body POSTed to a webhook
+type webhookDelivery struct {
+	RunID  string        `json:"run_id"`
+	SentAt time.Time     `json:"sent_at"`
+	Events []changeEvent `json:"events"`
+}
+
+// webhookNotifier compares the fighters of a run with the previous run and sends the
+// changes to webhooks. Every delivery is signed with HMAC-SHA256 over
+// "<timestamp>.<body>", sent as X-MMA-Timestamp and X-MMA-Signature: sha256=<hex>.
+type webhookNotifier struct {
+	URLs     []string
+	Secret   string
+	Events   []string // Event types to send
+	Baseline string   // Snapshot of the previous run, read with loadSnapshot
+
+	retryDelay time.Duration // Delay before the first retry, the HTTP sink's when zero
+}
+
+// webhookClock is the time deliveries are signed with
+var webhookClock = time.Now
+
+// loadWebhookNotifier configures the notifier from MMA_WEBHOOK_URLS, a comma-separated list of
+// URLs, and MMA_WEBHOOK_SECRET, the signing key. MMA_WEBHOOK_EVENTS limits the event types,
+// and MMA_WEBHOOK_BASELINE is the snapshot to compare against, MMA_OUTPUT_FILE or
+// fighters.json by default. It returns nil when no URLs are set.
+func loadWebhookNotifier() (*webhookNotifier, error) {
+	var urls []string
+	for _, url := range strings.Split(os.Getenv("MMA_WEBHOOK_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	notifier := &webhookNotifier{
+		URLs:     urls,
+		Secret:   os.Getenv("MMA_WEBHOOK_SECRET"),
+		Events:   allChangeEvents,
+		Baseline: os.Getenv("MMA_WEBHOOK_BASELINE"),
+	}
+	if notifier.Secret == "" {
+		return nil, fmt.Errorf("webhooks need MMA_WEBHOOK_SECRET to sign their payloads")
+	}
+	if env := os.Getenv("MMA_WEBHOOK_EVENTS"); env != "" {
+		notifier.Events = nil
+		for _, event := range strings.Split(env, ",") {
+			event = strings.TrimSpace(event)
+			if !containsString(allChangeEvents, event) {
+				return nil, fmt.Errorf("unknown webhook event %q, expected one of %s", event, strings.Join(allChangeEvents, ", "))
+			}
+			notifier.Events = append(notifier.Events, event)
+		}
+	}
+	if notifier.Baseline == "" {
+		notifier.Baseline = os.Getenv("MMA_OUTPUT_FILE")
+	}
+	if notifier.Baseline == "" {
+		notifier.Baseline = defaultOutputFile
+	}
+	return notifier, nil
+}
+
+// loadBaseline reads the previous run. Call it before the sinks overwrite it. There is no
+// baseline on the first run, so nothing is sent rather than reporting every fighter as new.
+func (n *webhookNotifier) loadBaseline() []FighterStats {
+	baseline, err := loadSnapshot(n.Baseline)
+	if err != nil {
+		log.Printf("No webhook baseline (%v), skipping change notifications", err)
+		return nil
+	}
+	return baseline.Fighters
+}
+
+// notify sends the changes between the baseline and this run's fighters to every webhook
+func (n *webhookNotifier) notify(run *runInfo, baseline, fighters []FighterStats) {
+	if baseline == nil {
+		return
+	}
+	diff := diffDatasets(baseline, fighters)
+	events := n.filter(changeEvents(&diff))
+	if len(events) == 0 {
+		log.Println("No changes since the last run, no webhooks sent")
+		return
+	}
+
+	for _, url := range n.URLs {
+		sent := 0
+		for start := 0; start < len(events); start += webhookBatchSize {
+			end := start + webhookBatchSize
+			if end > len(events) {
+				end = len(events)
+			}
+			if err := n.deliver(url, run, events[start:end]); err != nil {
+				log.Printf("Error sending %d events to webhook %s: %v", end-start, url, err)
+				continue
+			}
+			sent += end - start
+		}
+		log.Printf("Sent %d of %d change events to webhook %s", sent, len(events), url)
+	}
+}
+
+func (n *webhookNotifier) filter(events []changeEvent) []changeEvent {
+	var filtered []changeEvent
+	for _, event := range events {
+		if containsString(n.Events, event.Type) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+// deliver signs and POSTs one batch of events, retrying like the HTTP sink
+func (n *webhookNotifier) deliver(url string, run *runInfo, events []changeEvent) error {
+	jsonData, err := json.Marshal(webhookDelivery{RunID: run.ID, SentAt: time.Now().UTC(), Events: events})
+	if err != nil {
+		return err
+	}
+	sink := newHTTPSink(url, nil, "", webhookBatchSize)
+	if n.retryDelay > 0 {
+		sink.BaseDelay, sink.MaxDelay = n.retryDelay, n.retryDelay
+	}
+
+	// Every attempt is signed afresh, so a retry after a long backoff isn't rejected as old. The
+	// delivery ID stays the same across retries, so receivers can deduplicate.
+	hash := sha256.Sum256(jsonData)
+	return sink.send(jsonData, hex.EncodeToString(hash[:16]), func(header http.Header) {
+		timestamp := strconv.FormatInt(webhookClock().Unix(), 10)
+		header.Set("X-MMA-Timestamp", timestamp)
+		header.Set("X-MMA-Signature", "sha256="+signWebhookPayload(n.Secret, timestamp, jsonData))
+	})
+}
+
+// signWebhookPayload is the HMAC-SHA256 of "<timestamp>.<body>". Receivers recompute it with
+// the shared secret and reject deliveries whose timestamp is too old.
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// changeEvents turns a diff into events, in the order of the diff's sections
+func changeEvents(diff *datasetDiff) []changeEvent {
+	var events []changeEvent
+	for _, fighter := range diff.NewFighters {
+		events = append(events, newChangeEvent(eventFighterDiscovered, fighter,
+			fmt.Sprintf("New fighter discovered: %s", fighter.Name)))
+	}
+	for _, fighter := range diff.RemovedFighters {
+		events = append(events, newChangeEvent(eventFighterRemoved, fighter,
+			fmt.Sprintf("Fighter no longer listed: %s", fighter.Name)))
+	}
+	for _, fight := range diff.NewFights {
+		events = append(events, newChangeEvent(eventFightRecorded, fight,
+			fmt.Sprintf("New fight result recorded: %s vs %s, %s, %s (%s)", fight.Name, fight.Opponent, fight.Date, fight.Event, fight.Result)))
+	}
+	for _, change := range diff.ChangedRecords {
+		events = append(events, newChangeEvent(eventRecordChanged, change,
+			fmt.Sprintf("Record changed: %s %s %s -> %s", change.Name, change.Field, change.Old, change.New)))
+	}
+	for _, change := range diff.ChangedBio {
+		events = append(events, newChangeEvent(eventBioChanged, change,
+			fmt.Sprintf("Bio changed: %s %s %q -> %q", change.Name, change.Field, change.Old, change.New)))
+	}
+	for _, change := range diff.CorrectedStats {
+		events = append(events, newChangeEvent(eventStatsCorrected, change,
+			fmt.Sprintf("Stats corrected: %s, %s vs %s on %s, %s %q -> %q", change.Name, change.Table, change.Opponent, change.Date, change.Field, change.Old, change.New)))
+	}
+	return events
+}
+
+func newChangeEvent(eventType string, data interface{}, summary string) changeEvent {
+	jsonData, _ := json.Marshal(data)
+	hash := sha256.Sum256(append([]byte(eventType+"\n"), jsonData...))
+	return changeEvent{
+		ID:      hex.EncodeToString(hash[:16]),
+		Type:    eventType,
+		Summary: summary,
+		Data:    data,
+	}
+}
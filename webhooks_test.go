@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookAttempt is one request a test webhook received
+type webhookAttempt struct {
+	Header http.Header
+	Body   []byte
+}
+
+// newTestWebhook records every request and answers them with statuses in turn, then 200
+func newTestWebhook(t *testing.T, statuses ...int) (*httptest.Server, func() []webhookAttempt) {
+	t.Helper()
+	var mu sync.Mutex
+	var attempts []webhookAttempt
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		attempts = append(attempts, webhookAttempt{Header: r.Header.Clone(), Body: body})
+		n := len(attempts)
+		mu.Unlock()
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []webhookAttempt {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]webhookAttempt(nil), attempts...)
+	}
+}
+
+// verifyWebhookSignature checks a request's signature the way a receiver would
+func verifyWebhookSignature(t *testing.T, secret string, attempt webhookAttempt) {
+	t.Helper()
+	timestamp := attempt.Header.Get("X-MMA-Timestamp")
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Fatalf("X-MMA-Timestamp %q isn't a Unix time", timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(attempt.Body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := attempt.Header.Get("X-MMA-Signature"); got != want {
+		t.Errorf("X-MMA-Signature = %q, want %q", got, want)
+	}
+}
+
+// stepClock returns a clock that moves a minute forward every time it is read
+func stepClock() func() time.Time {
+	now := time.Date(2024, 7, 11, 3, 15, 0, 0, time.UTC)
+	var mu sync.Mutex
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(time.Minute)
+		return now
+	}
+}
+
+var testChangeEvents = []changeEvent{
+	{ID: "36d03113c9ebb126abb3b6f97e53e77a", Type: eventFightRecorded, Summary: "New fight result recorded"},
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	server, attempts := newTestWebhook(t)
+	notifier := &webhookNotifier{Secret: "change-me"}
+	if err := notifier.deliver(server.URL, &runInfo{ID: "test-run"}, testChangeEvents); err != nil {
+		t.Fatal(err)
+	}
+
+	got := attempts()
+	if len(got) != 1 {
+		t.Fatalf("%d requests, want 1", len(got))
+	}
+	verifyWebhookSignature(t, "change-me", got[0])
+	var delivery webhookDelivery
+	if err := json.Unmarshal(got[0].Body, &delivery); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.RunID != "test-run" || len(delivery.Events) != 1 || delivery.Events[0].ID != testChangeEvents[0].ID {
+		t.Errorf("delivery %+v", delivery)
+	}
+	if got[0].Header.Get("Idempotency-Key") == "" {
+		t.Error("no Idempotency-Key")
+	}
+}
+
+func TestWebhookRetriesAreSignedAgain(t *testing.T) {
+	defer func(clock func() time.Time) { webhookClock = clock }(webhookClock)
+	webhookClock = stepClock()
+
+	server, attempts := newTestWebhook(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	notifier := &webhookNotifier{Secret: "change-me", retryDelay: time.Millisecond}
+	if err := notifier.deliver(server.URL, &runInfo{ID: "test-run"}, testChangeEvents); err != nil {
+		t.Fatal(err)
+	}
+
+	got := attempts()
+	if len(got) != 3 {
+		t.Fatalf("%d requests, want 3", len(got))
+	}
+	for i, attempt := range got {
+		verifyWebhookSignature(t, "change-me", attempt)
+		if i == 0 {
+			continue
+		}
+		// A fresh timestamp on every attempt, and the same delivery ID
+		if attempt.Header.Get("X-MMA-Timestamp") == got[i-1].Header.Get("X-MMA-Timestamp") {
+			t.Errorf("attempt %d reused the timestamp %s", i+1, attempt.Header.Get("X-MMA-Timestamp"))
+		}
+		if attempt.Header.Get("Idempotency-Key") != got[0].Header.Get("Idempotency-Key") {
+			t.Errorf("attempt %d has Idempotency-Key %q, the first had %q", i+1, attempt.Header.Get("Idempotency-Key"), got[0].Header.Get("Idempotency-Key"))
+		}
+		if string(attempt.Body) != string(got[0].Body) {
+			t.Errorf("attempt %d has a different body", i+1)
+		}
+	}
+}
+
+func TestWebhookGivesUpOnClientErrors(t *testing.T) {
+	server, attempts := newTestWebhook(t, http.StatusBadRequest)
+	notifier := &webhookNotifier{Secret: "change-me", retryDelay: time.Millisecond}
+	if err := notifier.deliver(server.URL, &runInfo{ID: "test-run"}, testChangeEvents); err == nil {
+		t.Error("no error for a 400")
+	}
+	if got := attempts(); len(got) != 1 {
+		t.Errorf("%d requests, want 1", len(got))
+	}
+}